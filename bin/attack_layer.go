@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Velocidex/registry_hunter/compiler"
+	"github.com/alecthomas/kingpin"
+)
+
+var (
+	attack_layer_cmd  = app.Command("attack-layer", "Write an ATT&CK Navigator layer showing the techniques covered by the rules.")
+	attack_layer_yaml = attack_layer_cmd.Arg("input", "Path to the registry hunter yamls files").
+				Required().Strings()
+
+	attack_layer_output = attack_layer_cmd.Flag("output", "Where to write the layer JSON").
+				Required().String()
+
+	attack_layer_name = attack_layer_cmd.Flag("name", "The name of the layer").
+				Default("Registry Hunter").String()
+)
+
+func doAttackLayer() error {
+	rules_compiler := compiler.NewCompiler()
+	for _, filename := range *attack_layer_yaml {
+		rules_compiler.LoadRules(filename)
+	}
+
+	diagnostics := rules_compiler.Diagnostics()
+	if len(diagnostics) > 0 {
+		writeDiagnostics(os.Stdout, "text", diagnostics)
+	}
+
+	err := diagnostics.Err()
+	if err != nil {
+		return err
+	}
+
+	layer := rules_compiler.AttackLayer(*attack_layer_name)
+	serialized, err := json.MarshalIndent(layer, "", " ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(*attack_layer_output, serialized, 0600)
+	if err != nil {
+		return err
+	}
+
+	covered := 0
+	for _, t := range layer.Techniques {
+		if t.Score > 0 {
+			covered++
+		}
+	}
+
+	fmt.Printf("Wrote %v covered techniques to %v\n",
+		covered, *attack_layer_output)
+	return nil
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case attack_layer_cmd.FullCommand():
+			err := doAttackLayer()
+			kingpin.FatalIfError(err, "Building ATT&CK layer")
+
+		default:
+			return false
+		}
+		return true
+	})
+}
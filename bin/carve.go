@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Velocidex/registry_hunter/regf"
+	"github.com/alecthomas/kingpin"
+)
+
+var (
+	carve_cmd  = app.Command("carve", "Carve the deleted keys and values from a hive file and write them to a new hive.")
+	carve_hive = carve_cmd.Arg("hive", "Path to the primary hive file").
+			Required().String()
+
+	carve_logs = carve_cmd.Flag("log", "Replay this transaction log before carving").
+			Strings()
+
+	carve_output = carve_cmd.Flag("output", "Where to write the carved hive").
+			Required().String()
+)
+
+func doCarve() error {
+	hive, err := regf.Open(*carve_hive)
+	if err != nil {
+		return err
+	}
+
+	if len(*carve_logs) > 0 {
+		var logs [][]byte
+		for _, path := range *carve_logs {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			logs = append(logs, data)
+		}
+		hive, err = hive.Replay(logs...)
+		if err != nil {
+			return err
+		}
+	}
+
+	spec, found := hive.CarveDeleted()
+	if !found {
+		return errors.New("No deleted keys or values found")
+	}
+
+	data, err := regf.BuildHive(spec)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Carved the deleted keys and values of %v\n", *carve_hive)
+	return os.WriteFile(*carve_output, data, 0600)
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case carve_cmd.FullCommand():
+			err := doCarve()
+			kingpin.FatalIfError(err, "Carving deleted keys and values")
+
+		default:
+			return false
+		}
+		return true
+	})
+}
@@ -4,8 +4,12 @@ import (
 	"archive/zip"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/Velocidex/registry_hunter/compiler"
+	"github.com/Velocidex/yaml/v2"
 	"github.com/alecthomas/kingpin"
 )
 
@@ -24,9 +28,65 @@ var (
 
 	output_index = compile_cmd.Flag("index", "Where to write the rules index").
 			String()
+
+	compile_strict = compile_cmd.Flag("strict", "Fail the build if rules have conflicting globs").
+			Bool()
+
+	compile_merge = compile_cmd.Flag("merge", "Keep all rules sharing the same glob and combine their Details into one row instead of dropping the glob from the later rule").
+			Bool()
+
+	compile_diagnostics_format = compile_cmd.Flag("diagnostics_format", "How to report problems with the rules").
+					Default("text").Enum("text", "json", "sarif")
+
+	compile_diagnostics_output = compile_cmd.Flag("diagnostics_output", "Where to write the diagnostics (default stdout)").
+					String()
+
+	compile_name = compile_cmd.Flag("name", "The name of the compiled artifact").
+			Default(compiler.DEFAULT_ARTIFACT_NAME).String()
+
+	compile_split = compile_cmd.Flag("split", "Build one artifact per category, a common artifact and an artifact collecting them all (--output is a directory unless --make_zip is given)").
+			Bool()
+
+	compile_template = compile_cmd.Flag("template", "A template to use instead of the built in artifact template").
+				String()
+
+	compile_meta_template = compile_cmd.Flag("meta-template", "A template to use instead of the built in meta artifact template").
+				String()
+
+	compile_template_data = compile_cmd.Flag("template-data", "A YAML file with extra data available to the templates as .Data").
+				String()
+
+	compile_reproducible = compile_cmd.Flag("reproducible", "Produce identical output for identical rules. The build time is taken from SOURCE_DATE_EPOCH (default 1970-01-01)").
+				Bool()
+
+	compile_manifest = compile_cmd.Flag("manifest", "Where to write a manifest with the SHA-256 of every output (default <output>.manifest.json with --reproducible)").
+				String()
+
+	compile_category = compile_cmd.Flag("category", "Only include rules in this category (may be repeated)").
+				Strings()
+
+	compile_exclude_category = compile_cmd.Flag("exclude-category", "Exclude rules in this category (may be repeated)").
+					Strings()
+
+	compile_rule_id = compile_cmd.Flag("rule-id", "Only include the rule with this Id (may be repeated)").
+			Strings()
+
+	compile_tag = compile_cmd.Flag("tag", "Only include rules with this tag (may be repeated)").
+			Strings()
+
+	compile_root = compile_cmd.Flag("root", "Only include rules under this registry root (may be repeated)").
+			Strings()
 )
 
-func makeZip(rules_compiler *compiler.Compiler) error {
+func zipHeader(rules_compiler *compiler.Compiler, name string) *zip.FileHeader {
+	return &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: rules_compiler.BuildTime.UTC(),
+	}
+}
+
+func makeZip(rules_compiler *compiler.Compiler, outputs *manifest) error {
 	out_fd, err := os.OpenFile(*output_artifact,
 		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
@@ -34,94 +94,239 @@ func makeZip(rules_compiler *compiler.Compiler) error {
 	}
 	defer out_fd.Close()
 
+	artifacts, _, err := rules_compiler.CompileArtifacts()
+	if err != nil {
+		return err
+	}
+
 	w := zip.NewWriter(out_fd)
-	defer w.Close()
+	for _, artifact := range artifacts {
+		f, err := w.CreateHeader(zipHeader(rules_compiler, artifact.Name+".yaml"))
+		if err != nil {
+			return err
+		}
 
-	artifact, err := rules_compiler.Compile()
+		_, err = f.Write([]byte(artifact.Definition))
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := w.CreateHeader(zipHeader(rules_compiler, "rules.txt"))
 	if err != nil {
 		return err
 	}
 
-	f, err := w.Create("Windows.Registry.Hunter.yaml")
-	_, err = f.Write([]byte(artifact))
+	_, err = f.Write([]byte(rules_compiler.GetRules()))
 	if err != nil {
 		return err
 	}
 
-	f, err = w.Create("rules.txt")
-	_, err = f.Write([]byte(rules_compiler.GetRules()))
+	err = w.Close()
 	if err != nil {
 		return err
 	}
 
-	return err
+	outputs.Add(*output_artifact)
+	return out_fd.Close()
 }
 
-func makeFile(rules_compiler *compiler.Compiler) error {
-	out_fd, err := os.OpenFile(*output_artifact,
+func writeFile(filename string, data string) error {
+	out_fd, err := os.OpenFile(filename,
 		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 	defer out_fd.Close()
 
-	artifact, err := rules_compiler.Compile()
+	_, err = out_fd.Write([]byte(data))
+	return err
+}
+
+func makeFile(rules_compiler *compiler.Compiler, outputs *manifest) error {
+	artifacts, _, err := rules_compiler.CompileArtifacts()
 	if err != nil {
 		return err
 	}
 
-	_, err = out_fd.Write([]byte(artifact))
-	return err
-}
+	if !rules_compiler.Split {
+		outputs.Add(*output_artifact)
+		return writeFile(*output_artifact, artifacts[0].Definition)
+	}
 
-func makeMetaFile(rules_compiler *compiler.Compiler) error {
-	out_fd, err := os.OpenFile(*output_meta_artifact,
-		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	// Split artifacts are written into the output directory.
+	err = os.MkdirAll(*output_artifact, 0700)
 	if err != nil {
 		return err
 	}
-	defer out_fd.Close()
 
+	for _, artifact := range artifacts {
+		path := filepath.Join(*output_artifact, artifact.Name+".yaml")
+		err := writeFile(path, artifact.Definition)
+		if err != nil {
+			return err
+		}
+		outputs.Add(path)
+	}
+	return nil
+}
+
+func makeMetaFile(rules_compiler *compiler.Compiler, outputs *manifest) error {
 	artifact, err := rules_compiler.CompileMeta()
 	if err != nil {
 		return err
 	}
 
-	_, err = out_fd.Write([]byte(artifact))
-	return err
+	outputs.Add(*output_meta_artifact)
+	return writeFile(*output_meta_artifact, artifact)
 }
 
-func doCompile() error {
-	rules_compiler := compiler.NewCompiler()
+// The build time of reproducible builds, see
+// https://reproducible-builds.org/specs/source-date-epoch/
+func sourceDateEpoch() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
 
-	for _, filename := range *compile_yaml {
-		err := rules_compiler.LoadRules(filename)
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid SOURCE_DATE_EPOCH %q: %w", epoch, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+func readTemplateFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func getCompilerOptions() (options compiler.CompilerOptions, err error) {
+	options = compiler.CompilerOptions{
+		Strict: *compile_strict,
+		Merge:  *compile_merge,
+		Name:   *compile_name,
+		Split:  *compile_split,
+		Selection: compiler.RuleSelection{
+			Categories:        *compile_category,
+			ExcludeCategories: *compile_exclude_category,
+			RuleIds:           *compile_rule_id,
+			Tags:              *compile_tag,
+			Roots:             *compile_root,
+		},
+	}
+
+	options.Template, err = readTemplateFile(*compile_template)
+	if err != nil {
+		return options, err
+	}
+
+	options.MetaTemplate, err = readTemplateFile(*compile_meta_template)
+	if err != nil {
+		return options, err
+	}
+
+	if *compile_reproducible {
+		options.BuildTime, err = sourceDateEpoch()
+		if err != nil {
+			return options, err
+		}
+	}
+
+	if *compile_template_data != "" {
+		data, err := os.ReadFile(*compile_template_data)
+		if err != nil {
+			return options, err
+		}
+
+		err = yaml.Unmarshal(data, &options.TemplateData)
 		if err != nil {
-			fmt.Printf("Error: Unable to load rules from %v: %v\n",
-				filename, err)
-			continue
+			return options, fmt.Errorf("%v: %w", *compile_template_data, err)
 		}
 	}
 
+	return options, nil
+}
+
+func doCompile() error {
+	options, err := getCompilerOptions()
+	if err != nil {
+		return err
+	}
+
+	rules_compiler := compiler.NewCompilerWithOptions(options)
+	err = rules_compiler.ValidateTemplates()
+	if err != nil {
+		return err
+	}
+
+	// Problems with the rule files are reported as diagnostics so
+	// we can report all of them at once.
+	for _, filename := range *compile_yaml {
+		rules_compiler.LoadRules(filename)
+	}
+
+	diagnostics := rules_compiler.Diagnostics()
+	err = reportDiagnostics(*compile_diagnostics_output,
+		*compile_diagnostics_format, diagnostics)
+	if err != nil {
+		return err
+	}
+
+	err = diagnostics.Err()
+	if err != nil {
+		return err
+	}
+
+	outputs := &manifest{}
+	if *compile_reproducible {
+		outputs.BuildTime = options.BuildTime.Format(time.RFC3339)
+	}
+
+	err = writeOutputs(rules_compiler, outputs)
+	if err != nil {
+		return err
+	}
+
+	manifest_path := *compile_manifest
+	if manifest_path == "" && *compile_reproducible {
+		manifest_path = *output_artifact + ".manifest.json"
+	}
+
+	if manifest_path != "" {
+		return outputs.Write(manifest_path)
+	}
+	return nil
+}
+
+func writeOutputs(rules_compiler *compiler.Compiler, outputs *manifest) error {
 	if *output_index != "" {
 		err := rules_compiler.WriteIndex(*output_index)
 		if err != nil {
 			return err
 		}
+		outputs.Add(*output_index)
 	}
 
 	if *output_make_zip {
-		return makeZip(rules_compiler)
+		return makeZip(rules_compiler, outputs)
 	}
 
 	if *output_meta_artifact != "" {
-		err := makeMetaFile(rules_compiler)
+		err := makeMetaFile(rules_compiler, outputs)
 		if err != nil {
 			return err
 		}
 	}
 
-	return makeFile(rules_compiler)
+	return makeFile(rules_compiler, outputs)
 }
 
 func init() {
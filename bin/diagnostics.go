@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Velocidex/registry_hunter/compiler"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolURI      = "https://github.com/Velocidex/registry_hunter"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id string `json:"id"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+func sarifLevel(severity string) string {
+	switch severity {
+	case compiler.SEVERITY_ERROR:
+		return "error"
+	case compiler.SEVERITY_WARNING:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+func buildSarif(diagnostics compiler.Diagnostics) *sarifLog {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "reghunter",
+			InformationURI: toolURI,
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	codes := make(map[string]bool)
+	for _, d := range diagnostics {
+		codes[d.Code] = true
+
+		result := sarifResult{
+			RuleId:  d.Code,
+			Level:   sarifLevel(d.Severity),
+			Message: sarifMessage{Text: d.Message},
+		}
+
+		if d.RuleId != "" {
+			result.Properties = map[string]string{
+				"ruleId":      d.RuleId,
+				"description": d.Description,
+			}
+		}
+
+		if d.File != "" {
+			location := sarifLocation{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{
+						URI: filepath.ToSlash(d.File),
+					},
+				},
+			}
+			if d.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{
+					StartLine:   d.Line,
+					StartColumn: d.Column,
+				}
+			}
+			result.Locations = append(result.Locations, location)
+		}
+
+		run.Results = append(run.Results, result)
+	}
+
+	sorted_codes := []string{}
+	for k := range codes {
+		sorted_codes = append(sorted_codes, k)
+	}
+	sort.Strings(sorted_codes)
+
+	for _, code := range sorted_codes {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{Id: code})
+	}
+
+	return &sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	}
+}
+
+func writeDiagnostics(out io.Writer, format string,
+	diagnostics compiler.Diagnostics) error {
+	switch format {
+	case "json":
+		if diagnostics == nil {
+			diagnostics = compiler.Diagnostics{}
+		}
+		serialized, err := json.MarshalIndent(diagnostics, "", " ")
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(append(serialized, '\n'))
+		return err
+
+	case "sarif":
+		serialized, err := json.MarshalIndent(buildSarif(diagnostics), "", " ")
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(append(serialized, '\n'))
+		return err
+
+	default:
+		for _, d := range diagnostics {
+			fmt.Fprintf(out, "%v\n", d)
+		}
+		fmt.Fprintf(out, "%v errors, %v warnings\n",
+			diagnostics.Count(compiler.SEVERITY_ERROR),
+			diagnostics.Count(compiler.SEVERITY_WARNING))
+		return nil
+	}
+}
+
+// Write the diagnostics to the path or stdout if path is empty.
+func reportDiagnostics(path, format string,
+	diagnostics compiler.Diagnostics) error {
+	if path == "" {
+		return writeDiagnostics(os.Stdout, format, diagnostics)
+	}
+
+	out_fd, err := os.OpenFile(path,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out_fd.Close()
+
+	return writeDiagnostics(out_fd, format, diagnostics)
+}
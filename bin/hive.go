@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/Velocidex/registry_hunter/regf"
+	"github.com/alecthomas/kingpin"
+)
+
+var (
+	hive_cmd  = app.Command("hive", "Build a synthetic hive file from a YAML description.")
+	hive_spec = hive_cmd.Arg("spec", "Path to the YAML hive description").
+			Required().String()
+
+	hive_output = hive_cmd.Flag("output", "Where to write the hive file").
+			Required().String()
+)
+
+func doHive() error {
+	spec, err := regf.LoadHiveSpecFile(*hive_spec)
+	if err != nil {
+		return err
+	}
+
+	return regf.WriteHiveFile(spec, *hive_output)
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case hive_cmd.FullCommand():
+			err := doHive()
+			kingpin.FatalIfError(err, "Building hive")
+
+		default:
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/Velocidex/registry_hunter/compiler"
+	"github.com/alecthomas/kingpin"
+)
+
+var (
+	lint_cmd  = app.Command("lint", "Check the VQL and globs in the rules without needing Velociraptor.")
+	lint_yaml = lint_cmd.Arg("input", "Path to the registry hunter yamls files to check").
+			Required().Strings()
+
+	lint_diagnostics_format = lint_cmd.Flag("diagnostics_format", "How to report problems with the rules").
+				Default("text").Enum("text", "json", "sarif")
+
+	lint_diagnostics_output = lint_cmd.Flag("diagnostics_output", "Where to write the diagnostics (default stdout)").
+				String()
+)
+
+func doLint() error {
+	rules_compiler := compiler.NewCompiler()
+	for _, filename := range *lint_yaml {
+		rules_compiler.LoadRules(filename)
+	}
+
+	diagnostics := append(rules_compiler.Diagnostics(), rules_compiler.Lint()...)
+	err := reportDiagnostics(*lint_diagnostics_output,
+		*lint_diagnostics_format, diagnostics)
+	if err != nil {
+		return err
+	}
+
+	return diagnostics.Err()
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case lint_cmd.FullCommand():
+			err := doLint()
+			kingpin.FatalIfError(err, "Linting rules")
+
+		default:
+			return false
+		}
+		return true
+	})
+}
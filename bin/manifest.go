@@ -0,0 +1,103 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+)
+
+type manifestEntry struct {
+	Path   string `json:"Path"`
+	SHA256 string `json:"SHA256"`
+	Size   int64  `json:"Size"`
+}
+
+// Records the hashes of all the files written by the build so they
+// can be verified later.
+type manifest struct {
+	BuildTime string          `json:"BuildTime,omitempty"`
+	Files     []manifestEntry `json:"Files"`
+
+	paths []string
+}
+
+func (self *manifest) Add(path string) {
+	self.paths = append(self.paths, path)
+}
+
+func hashReader(path string, reader io.Reader) (manifestEntry, error) {
+	h := sha256.New()
+	size, err := io.Copy(h, reader)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	return manifestEntry{
+		Path:   path,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Size:   size,
+	}, nil
+}
+
+func (self *manifest) hashFile(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	entry, err := hashReader(path, fd)
+	if err != nil {
+		return err
+	}
+	self.Files = append(self.Files, entry)
+
+	if !strings.HasSuffix(path, ".zip") {
+		return nil
+	}
+
+	// Also hash each member so extracted artifacts can be verified.
+	zip_reader, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zip_reader.Close()
+
+	for _, f := range zip_reader.File {
+		member, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		entry, err := hashReader(path+":"+f.Name, member)
+		member.Close()
+		if err != nil {
+			return err
+		}
+		self.Files = append(self.Files, entry)
+	}
+
+	return nil
+}
+
+// Hash all the files once they are written and store the manifest.
+func (self *manifest) Write(path string) error {
+	self.Files = nil
+	for _, p := range self.paths {
+		err := self.hashFile(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	serialized, err := json.MarshalIndent(self, "", " ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, string(serialized)+"\n")
+}
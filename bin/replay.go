@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Velocidex/registry_hunter/executor"
+	"github.com/Velocidex/registry_hunter/regf"
+	"github.com/alecthomas/kingpin"
+)
+
+var (
+	replay_cmd  = app.Command("replay", "Apply the transaction logs (.LOG1/.LOG2) to a hive file and write the recovered hive.")
+	replay_hive = replay_cmd.Arg("hive", "Path to the primary hive file").
+			Required().String()
+
+	replay_logs = replay_cmd.Flag("log", "Path to a transaction log (default the logs next to the hive)").
+			Strings()
+
+	replay_output = replay_cmd.Flag("output", "Where to write the recovered hive").
+			Required().String()
+)
+
+func doReplay() error {
+	hive, err := regf.Open(*replay_hive)
+	if err != nil {
+		return err
+	}
+
+	logs := executor.ReadTransactionLogs(*replay_hive)
+	if len(*replay_logs) > 0 {
+		logs = nil
+		for _, path := range *replay_logs {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			logs = append(logs, data)
+		}
+	}
+
+	replayed, err := hive.Replay(logs...)
+	if err != nil {
+		return err
+	}
+
+	if !replayed.Replayed() {
+		return errors.New("No transaction log entries to replay")
+	}
+
+	fmt.Printf("Recovered hive with sequence number %v\n",
+		replayed.SecondarySequence)
+	return os.WriteFile(*replay_output, replayed.Bytes(), 0600)
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case replay_cmd.FullCommand():
+			err := doReplay()
+			kingpin.FatalIfError(err, "Replaying transaction logs")
+
+		default:
+			return false
+		}
+		return true
+	})
+}
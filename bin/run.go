@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/Velocidex/registry_hunter/compiler"
+	"github.com/Velocidex/registry_hunter/config"
+	"github.com/Velocidex/registry_hunter/executor"
+	"github.com/alecthomas/kingpin"
+)
+
+var (
+	run_cmd  = app.Command("run", "Run the rules directly over raw hive files without Velociraptor.")
+	run_yaml = run_cmd.Arg("input", "Path to the registry hunter yamls files to run").
+			Required().Strings()
+
+	run_root_drive = run_cmd.Flag("root_drive", "Path to the top level drive containing the hives").
+			Required().String()
+
+	run_output = run_cmd.Flag("output", "Where to write the JSONL results").
+			Required().String()
+
+	run_rule_filter = run_cmd.Flag("rule_filter", "Only run rules with a description or Id matching this regex").
+			Default(".").String()
+
+	run_merge = run_cmd.Flag("merge", "Run all rules sharing the same glob instead of dropping the glob from the later rule").
+			Bool()
+
+	run_user_hive_key = run_cmd.Flag("user_hive_key", "Mount user hives under their profile folder name, their SID from the ProfileList or both").
+				Default(config.USER_KEY_USERNAME).
+				Enum(config.USER_KEY_USERNAME, config.USER_KEY_SID, config.USER_KEY_BOTH)
+
+	run_transaction_logs = run_cmd.Flag("transaction_logs", "Use the primary hive files, replay their transaction logs (.LOG1/.LOG2) or use both").
+				Default(executor.TRANSACTION_LOGS_PRIMARY).
+				Enum(executor.TRANSACTION_LOGS_PRIMARY, executor.TRANSACTION_LOGS_REPLAYED, executor.TRANSACTION_LOGS_BOTH)
+
+	run_deleted = run_cmd.Flag("deleted", "Also match the rules against the deleted keys and values carved from the hives").
+			Bool()
+
+	run_experimental = run_cmd.Flag("experimental", "Also run the experimental rules").
+				Bool()
+
+	run_min_severity = run_cmd.Flag("min_severity", "Only run rules with at least this severity").
+				Default(config.RULE_SEVERITY_INFO).Enum(config.RuleSeverities...)
+)
+
+func doRun() error {
+	rule_filter, err := regexp.Compile(*run_rule_filter)
+	if err != nil {
+		return err
+	}
+
+	rules_compiler := compiler.NewCompiler()
+	rules_compiler.Merge = *run_merge
+	for _, filename := range *run_yaml {
+		rules_compiler.LoadRules(filename)
+	}
+
+	diagnostics := rules_compiler.Diagnostics()
+	if len(diagnostics) > 0 {
+		writeDiagnostics(os.Stdout, "text", diagnostics)
+	}
+
+	err = diagnostics.Err()
+	if err != nil {
+		return err
+	}
+
+	rules := []config.RegistryRule{}
+	for _, r := range rules_compiler.Rules() {
+		if config.SeverityLevel(r.Severity) <
+			config.SeverityLevel(*run_min_severity) {
+			continue
+		}
+
+		if r.Status == config.RULE_STATUS_EXPERIMENTAL && !*run_experimental {
+			continue
+		}
+
+		if rule_filter.MatchString(r.Description) ||
+			rule_filter.MatchString(r.Id) {
+			if *run_rule_filter != "." &&
+				r.Status == config.RULE_STATUS_DEPRECATED {
+				fmt.Printf("Warning: %v\n", compiler.DeprecationMessage(&r))
+			}
+			rules = append(rules, r)
+		}
+	}
+
+	out_fd, err := os.OpenFile(*run_output,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out_fd.Close()
+
+	paths := executor.DefaultHivePaths(*run_root_drive)
+	paths.UserHiveKey = *run_user_hive_key
+	paths.TransactionLogs = *run_transaction_logs
+	paths.RecoverDeleted = *run_deleted
+
+	registry := executor.NewRegistry()
+	for _, mount := range registry.MountHives(paths) {
+		if mount.Error != "" {
+			fmt.Printf("%v: %v: %v\n", mount.Description, mount.HivePath, mount.Error)
+		} else if mount.Replayed {
+			fmt.Printf("%v: %v: Replayed transaction logs\n", mount.Description, mount.HivePath)
+		}
+	}
+
+	count := 0
+	rules_executor := executor.NewExecutor(registry)
+	rules_executor.Run(rules, func(row *ordereddict.Dict) {
+		serialized, err := json.Marshal(row)
+		if err != nil {
+			return
+		}
+		out_fd.Write(serialized)
+		out_fd.Write([]byte("\n"))
+		count++
+	})
+
+	for _, err := range rules_executor.Errors() {
+		fmt.Printf("Rule Skipped: %v: %v\n", err.Description, err.Error)
+	}
+
+	fmt.Printf("Wrote %v rows to %v\n", count, *run_output)
+	return nil
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case run_cmd.FullCommand():
+			err := doRun()
+			kingpin.FatalIfError(err, "Running rules")
+
+		default:
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Velocidex/registry_hunter/compiler"
+	"github.com/alecthomas/kingpin"
+)
+
+var (
+	schema_cmd  = app.Command("schema", "Write a JSON Schema of the rule files for editors.")
+	schema_yaml = schema_cmd.Arg("input", "Rule files to take the known categories from").
+			Strings()
+
+	schema_output = schema_cmd.Flag("output", "Where to write the schema").
+			Required().String()
+)
+
+func doSchema() error {
+	rules_compiler := compiler.NewCompiler()
+	for _, filename := range *schema_yaml {
+		rules_compiler.LoadRules(filename)
+	}
+
+	schema := rules_compiler.Schema()
+	serialized, err := json.MarshalIndent(schema, "", " ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(*schema_output, serialized, 0644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote schema to %v\n", *schema_output)
+	return nil
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case schema_cmd.FullCommand():
+			err := doSchema()
+			kingpin.FatalIfError(err, "Writing schema")
+
+		default:
+			return false
+		}
+		return true
+	})
+}
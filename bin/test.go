@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/Velocidex/registry_hunter/compiler"
+	"github.com/Velocidex/registry_hunter/executor"
+	"github.com/alecthomas/kingpin"
+)
+
+var (
+	test_cmd  = app.Command("test", "Run the tests embedded in the rules.")
+	test_yaml = test_cmd.Arg("input", "Path to the registry hunter yamls files to test").
+			Required().Strings()
+
+	test_rule_filter = test_cmd.Flag("rule_filter", "Only test rules with a description matching this regex").
+				Default(".").String()
+)
+
+func doTest() error {
+	rule_filter, err := regexp.Compile(*test_rule_filter)
+	if err != nil {
+		return err
+	}
+
+	rules_compiler := compiler.NewCompiler()
+	for _, filename := range *test_yaml {
+		rules_compiler.LoadRules(filename)
+	}
+
+	diagnostics := rules_compiler.Diagnostics()
+	if len(diagnostics) > 0 {
+		writeDiagnostics(os.Stdout, "text", diagnostics)
+	}
+
+	err = diagnostics.Err()
+	if err != nil {
+		return err
+	}
+
+	passed, failed, skipped := 0, 0, 0
+	for _, rule_tests := range rules_compiler.Tests() {
+		if !rule_filter.MatchString(rule_tests.Rule.Description) {
+			continue
+		}
+
+		results := executor.RunTests(rule_tests.Rule, rule_tests.Tests,
+			filepath.Dir(rule_tests.Filename))
+		for _, result := range results {
+			switch {
+			case result.Skipped != "":
+				fmt.Printf("SKIP: %v: %v: %v\n",
+					result.Description, result.Name, result.Skipped)
+				skipped++
+
+			case result.Passed():
+				fmt.Printf("PASS: %v: %v\n", result.Description, result.Name)
+				passed++
+
+			default:
+				fmt.Printf("FAIL: %v: %v (%v)\n", result.Description,
+					result.Name, rule_tests.Rule.Source)
+				for _, e := range result.Errors {
+					fmt.Printf("    %v\n", e)
+				}
+				failed++
+			}
+		}
+	}
+
+	fmt.Printf("%v passed, %v failed, %v skipped\n", passed, failed, skipped)
+	if failed > 0 {
+		return fmt.Errorf("%v tests failed", failed)
+	}
+	return nil
+}
+
+func init() {
+	command_handlers = append(command_handlers, func(command string) bool {
+		switch command {
+		case test_cmd.FullCommand():
+			err := doTest()
+			kingpin.FatalIfError(err, "Testing rules")
+
+		default:
+			return false
+		}
+		return true
+	})
+}
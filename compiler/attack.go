@@ -0,0 +1,150 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	ATTACK_NAVIGATOR_VERSION = "5.1.0"
+	ATTACK_LAYER_VERSION     = "4.5"
+)
+
+// An ATT&CK Navigator layer showing the techniques covered by the
+// rules. See https://github.com/mitre-attack/attack-navigator
+type AttackLayer struct {
+	Name        string               `json:"name"`
+	Versions    AttackLayerVersions  `json:"versions"`
+	Domain      string               `json:"domain"`
+	Description string               `json:"description"`
+	Techniques  []AttackLayerEntry   `json:"techniques"`
+	Gradient    AttackLayerGradient  `json:"gradient"`
+	Legend      []AttackLayerLegend  `json:"legendItems"`
+	Metadata    []AttackLayerComment `json:"metadata"`
+}
+
+type AttackLayerVersions struct {
+	Attack    string `json:"attack"`
+	Navigator string `json:"navigator"`
+	Layer     string `json:"layer"`
+}
+
+// A technique in the layer. The score is the number of rules
+// detecting it and the metadata lists the rules.
+type AttackLayerEntry struct {
+	TechniqueID       string               `json:"techniqueID"`
+	Score             int                  `json:"score,omitempty"`
+	Comment           string               `json:"comment,omitempty"`
+	Enabled           bool                 `json:"enabled"`
+	ShowSubtechniques bool                 `json:"showSubtechniques"`
+	Metadata          []AttackLayerComment `json:"metadata,omitempty"`
+}
+
+type AttackLayerGradient struct {
+	Colors   []string `json:"colors"`
+	MinValue int      `json:"minValue"`
+	MaxValue int      `json:"maxValue"`
+}
+
+type AttackLayerLegend struct {
+	Label string `json:"label"`
+	Color string `json:"color"`
+}
+
+type AttackLayerComment struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Build the layer from the loaded rules.
+func (self *Compiler) AttackLayer(name string) *AttackLayer {
+	rules := self.Rules()
+
+	// The rules detecting each technique
+	covered := make(map[string][]string)
+	rule_count := 0
+	for _, r := range rules {
+		if len(r.Techniques) > 0 {
+			rule_count++
+		}
+
+		for _, t := range r.Techniques {
+			covered[t] = append(covered[t],
+				fmt.Sprintf("%v (%v)", r.Description, r.Id))
+		}
+	}
+
+	result := &AttackLayer{
+		Name: name,
+		Versions: AttackLayerVersions{
+			Attack:    self.attack.Version,
+			Navigator: ATTACK_NAVIGATOR_VERSION,
+			Layer:     ATTACK_LAYER_VERSION,
+		},
+		Domain: "enterprise-attack",
+		Description: fmt.Sprintf(
+			"Techniques detected by %v of the %v Registry Hunter rules",
+			rule_count, len(rules)),
+		Gradient: AttackLayerGradient{
+			Colors:   []string{"#ffffffff", "#66b1ffff", "#ff6666ff"},
+			MinValue: 0,
+		},
+		Legend:   []AttackLayerLegend{},
+		Metadata: []AttackLayerComment{},
+	}
+
+	// Sub-techniques are hidden in the Navigator unless their parent
+	// is expanded.
+	expanded := make(map[string]bool)
+	for id := range covered {
+		technique := self.attack.Technique(id)
+		if technique != nil && technique.Parent() != id {
+			expanded[technique.Parent()] = true
+		}
+	}
+
+	for id := range expanded {
+		if _, pres := covered[id]; !pres {
+			covered[id] = nil
+		}
+	}
+
+	ids := []string{}
+	for id := range covered {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		entry := AttackLayerEntry{
+			TechniqueID:       id,
+			Score:             len(covered[id]),
+			Enabled:           true,
+			ShowSubtechniques: expanded[id],
+		}
+
+		if entry.Score > 0 {
+			entry.Comment = fmt.Sprintf("%v rules", entry.Score)
+			if entry.Score == 1 {
+				entry.Comment = "1 rule"
+			}
+		}
+
+		for _, description := range covered[id] {
+			entry.Metadata = append(entry.Metadata, AttackLayerComment{
+				Name: "Rule", Value: description,
+			})
+		}
+
+		if entry.Score > result.Gradient.MaxValue {
+			result.Gradient.MaxValue = entry.Score
+		}
+		result.Techniques = append(result.Techniques, entry)
+	}
+
+	if result.Techniques == nil {
+		result.Techniques = []AttackLayerEntry{}
+	}
+
+	return result
+}
@@ -0,0 +1,70 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const attackRules = `
+Rules:
+- Id: run
+  Description: Run keys
+  Category: ASEP
+  Techniques: [t1547.001, T1547.001]
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\Run\*
+- Id: run-once
+  Description: RunOnce keys
+  Category: ASEP
+  Techniques: [T1547.001, T1112]
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\RunOnce\*
+- Id: bad
+  Description: Bad techniques
+  Category: ASEP
+  Techniques: [T9999, Persistence]
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\RunServices\*
+`
+
+func TestAttack(t *testing.T) {
+	rules_compiler := NewCompiler()
+	loadTestRules(t, rules_compiler, attackRules)
+
+	codes := []string{}
+	for _, d := range rules_compiler.Diagnostics() {
+		codes = append(codes, d.Severity+" "+d.Code)
+	}
+	assert.Equal(t, []string{
+		"warning unknown-technique",
+		"error invalid-technique",
+	}, codes)
+
+	// Techniques are normalized and deduplicated.
+	techniques := make(map[string][]string)
+	for _, r := range rules_compiler.Rules() {
+		techniques[r.Id] = r.Techniques
+	}
+	assert.Equal(t, map[string][]string{
+		"run":      {"T1547.001"},
+		"run-once": {"T1547.001", "T1112"},
+		"bad":      {"T9999"},
+	}, techniques)
+
+	layer := rules_compiler.AttackLayer("Test")
+	assert.Equal(t, "Techniques detected by 3 of the 3 Registry Hunter rules",
+		layer.Description)
+	assert.Equal(t, 2, layer.Gradient.MaxValue)
+
+	scores := make(map[string]int)
+	for _, entry := range layer.Techniques {
+		scores[entry.TechniqueID] = entry.Score
+
+		// The parent is expanded to show the sub-technique.
+		assert.Equal(t, entry.TechniqueID == "T1547", entry.ShowSubtechniques)
+	}
+	assert.Equal(t, map[string]int{
+		"T1112": 1, "T1547": 0, "T1547.001": 2, "T9999": 1,
+	}, scores)
+}
@@ -5,13 +5,11 @@ import (
 	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"os"
 	"regexp"
 	"sort"
 	"strings"
-	"time"
 
 	"github.com/Velocidex/ordereddict"
 	"github.com/Velocidex/registry_hunter/config"
@@ -20,31 +18,24 @@ import (
 	_ "embed"
 )
 
-var (
-	// The following roots refer to the virtual hives that are mounted
-	// on the remap config. Rules may not specify different roots from
-	// these.
-	allowedRoots = []string{
-		// Rules that do not glob can have an empty root glob.
-		"",
-		"/",
-		"Amcache",
-		"HKEY_USERS",
-		"SAM",
-		"HKEY_LOCAL_MACHINE\\Security",
-		"HKEY_LOCAL_MACHINE\\System",
-		"HKEY_LOCAL_MACHINE\\Software",
-	}
-)
-
 //go:embed template.yaml
 var artifact_template string
 
 //go:embed meta_template.yaml
 var artifact_meta_template string
 
+//go:embed template_sections.yaml
+var artifact_sections string
+
 type templateParameters struct {
 	Name     string
+	Artifact string
+
+	// Used by the split artifacts
+	Common            string
+	Category          string
+	CategoryArtifacts []CategoryArtifact
+
 	Metadata string
 	Rules    []config.RegistryRule
 	Preamble string
@@ -56,28 +47,83 @@ type templateParameters struct {
 	CategoriesJSON string
 
 	Time string
+
+	// Generated from the mounts (see remapping.go)
+	Remapping *remapParameters
+
+	// Extra data from CompilerOptions.TemplateData
+	Data map[string]interface{}
+}
+
+// The embedded tests of a rule along with the normalized rule.
+type RuleTests struct {
+	Filename string
+	Rule     config.RegistryRule
+	Tests    []config.RuleTest
 }
 
 type Compiler struct {
+	CompilerOptions
+
+	// All the rules as loaded from the rule files.
+	loaded []config.RegistryRule
+
+	// The rules that remain after resolving conflicts.
 	rules []config.RegistryRule
-	md    map[string]config.RegistryRule
 
-	// Detect rules using the same globs - these are not supported and
-	// one of the rules will be rejected
-	globs map[string]config.RegistryRule
+	// The enabled rules by Id.
+	md map[string]config.RegistryRule
+
+	// All rules must have a unique ID.
+	ids map[string]config.RegistryRule
+
+	// Diagnostics produced while loading the rules.
+	diagnostics Diagnostics
+
+	// Conflicts between rules found by Resolve()
+	conflicts           []Conflict
+	resolve_diagnostics Diagnostics
+	resolved            bool
+
+	PreambleVerses []PreambleVerse
 
-	PreambleVerses []string
+	// The preamble verses actually used by the rules, found by
+	// Resolve()
+	preamble []PreambleVerse
 
 	categories map[string]bool
 
+	// The ATT&CK techniques rules may refer to.
+	attack *config.Attack
+
+	// Used to check the structure of the rule files.
+	schema *Schema
+
 	queries []config.RegistryRule
+
+	tests []RuleTests
 }
 
 func NewCompiler() *Compiler {
+	return NewCompilerWithOptions(DefaultCompilerOptions())
+}
+
+func NewCompilerWithOptions(options CompilerOptions) *Compiler {
+	if options.Name == "" {
+		options.Name = DEFAULT_ARTIFACT_NAME
+	}
+
+	if options.Mounts == nil {
+		options.Mounts = config.DefaultMounts()
+	}
+
 	return &Compiler{
-		md:         make(map[string]config.RegistryRule),
-		globs:      make(map[string]config.RegistryRule),
-		categories: make(map[string]bool),
+		CompilerOptions: options,
+		md:              make(map[string]config.RegistryRule),
+		ids:             make(map[string]config.RegistryRule),
+		categories:      make(map[string]bool),
+		attack:          config.DefaultAttack(),
+		schema:          RuleFileSchema(),
 	}
 }
 
@@ -91,47 +137,200 @@ func (self *Compiler) serialize(item interface{}) string {
 
 var (
 	pathSepRegex = regexp.MustCompile(`[/\\]+`)
+
+	// Rule IDs are either UUIDs or simple slugs.
+	idRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
 )
 
-func (self *Compiler) normalizeRoot(description, root string) string {
-	for _, allowed := range allowedRoots {
+func (self *Compiler) addDiagnostic(severity, code, filename string,
+	r *config.RegistryRule, format string, args ...interface{}) {
+	self.diagnostics = append(self.diagnostics,
+		newDiagnostic(severity, code, filename, r, format, args...))
+}
+
+// Rule IDs must be present, well formed and unique across all the
+// rule files (see loadRules which records them). Returns false if the
+// rule should be rejected.
+func (self *Compiler) checkId(filename string, r *config.RegistryRule) bool {
+	if r.Id == "" {
+		self.addDiagnostic(SEVERITY_ERROR, CODE_MISSING_ID, filename, r,
+			"Rule %v has no Id", r.Description)
+		return false
+	}
+
+	if !idRegex.MatchString(r.Id) {
+		self.addDiagnostic(SEVERITY_ERROR, CODE_INVALID_ID, filename, r,
+			"Rule %v by %v has an invalid Id %q",
+			r.Description, r.Author, r.Id)
+		return false
+	}
+
+	existing_rule, pres := self.ids[r.Id]
+	if pres {
+		self.addDiagnostic(SEVERITY_ERROR, CODE_DUPLICATE_ID, filename, r,
+			"Rule %v by %v has the same Id (%v) as rule %v by %v",
+			r.Description, r.Author, r.Id,
+			existing_rule.Description, existing_rule.Author)
+		return false
+	}
+	return true
+}
+
+// The roots refer to the virtual hives that are mounted on the remap
+// config. Rules may not specify different roots from these.
+func (self *Compiler) allowedRoots() []string {
+	// Rules that do not glob can have an empty root glob.
+	return append([]string{"", "/"}, self.Mounts.Roots()...)
+}
+
+func (self *Compiler) normalizeRoot(
+	filename string, r *config.RegistryRule, root string) string {
+	for _, allowed := range self.allowedRoots() {
 		if strings.EqualFold(allowed, root) {
 			return allowed
 		}
 	}
 
-	fmt.Printf("Warning: Rule %v uses an unsupported Root: %v\n",
-		description, root)
+	self.addDiagnostic(SEVERITY_WARNING, CODE_UNSUPPORTED_ROOT, filename, r,
+		"Rule %v uses an unsupported Root: %v", r.Description, root)
 	return root
 }
 
-// FIXME: Currentl we duplicate the rules because each rule can only
-// have one glob but it would be ideal if the same rule could have
-// multiple globs.
-func (self *Compiler) normalizeRule(r *config.RegistryRule) []config.RegistryRule {
-	r.Glob = strings.TrimPrefix(pathSepRegex.ReplaceAllString(r.Glob, "\\"), "\\")
-	r.Root = self.normalizeRoot(r.Description,
+func normalizeGlob(glob string) string {
+	return strings.TrimPrefix(pathSepRegex.ReplaceAllString(glob, "\\"), "\\")
+}
+
+// Techniques must be ATT&CK technique ids. Ids missing from the
+// embedded list (e.g. from a newer ATT&CK version) are only warned
+// about.
+func (self *Compiler) normalizeTechniques(
+	filename string, r *config.RegistryRule) {
+	var techniques []string
+	for _, t := range r.Techniques {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if !config.TechniqueRegex.MatchString(t) {
+			self.addDiagnostic(SEVERITY_ERROR, CODE_INVALID_TECHNIQUE, filename, r,
+				"Rule %v has an invalid ATT&CK technique %q", r.Description, t)
+			continue
+		}
+
+		if self.attack.Technique(t) == nil {
+			self.addDiagnostic(SEVERITY_WARNING, CODE_UNKNOWN_TECHNIQUE, filename, r,
+				"Rule %v refers to %v which is not an ATT&CK v%v technique",
+				r.Description, t, self.attack.Version)
+		}
+
+		if !InString(techniques, t) {
+			techniques = append(techniques, t)
+		}
+	}
+	r.Techniques = techniques
+}
+
+// The Severity and Kind default to info and inventory.
+func (self *Compiler) normalizeSeverity(
+	filename string, r *config.RegistryRule) {
+	r.Severity = strings.ToLower(strings.TrimSpace(r.Severity))
+	if r.Severity == "" {
+		r.Severity = config.RULE_SEVERITY_INFO
+	}
+
+	if config.SeverityLevel(r.Severity) < 0 {
+		self.addDiagnostic(SEVERITY_ERROR, CODE_INVALID_SEVERITY, filename, r,
+			"Rule %v has an invalid severity %q (should be one of %v)",
+			r.Description, r.Severity,
+			strings.Join(config.RuleSeverities, ", "))
+	}
+
+	r.Kind = strings.ToLower(strings.TrimSpace(r.Kind))
+	if r.Kind == "" {
+		r.Kind = config.RULE_KIND_INVENTORY
+	}
+
+	if !InString(config.RuleKinds, r.Kind) {
+		self.addDiagnostic(SEVERITY_ERROR, CODE_INVALID_KIND, filename, r,
+			"Rule %v has an invalid kind %q (should be one of %v)",
+			r.Description, r.Kind, strings.Join(config.RuleKinds, ", "))
+	}
+}
+
+// The Status defaults to stable, or deprecated for rules replaced by
+// another rule.
+func (self *Compiler) normalizeStatus(
+	filename string, r *config.RegistryRule) {
+	r.Status = strings.ToLower(strings.TrimSpace(r.Status))
+	r.ReplacedBy = strings.TrimSpace(r.ReplacedBy)
+	if r.Status == "" {
+		r.Status = config.RULE_STATUS_STABLE
+		if r.ReplacedBy != "" {
+			r.Status = config.RULE_STATUS_DEPRECATED
+		}
+	}
+
+	if !InString(config.RuleStatuses, r.Status) {
+		self.addDiagnostic(SEVERITY_ERROR, CODE_INVALID_STATUS, filename, r,
+			"Rule %v has an invalid status %q (should be one of %v)",
+			r.Description, r.Status, strings.Join(config.RuleStatuses, ", "))
+
+	} else if r.ReplacedBy != "" && r.Status != config.RULE_STATUS_DEPRECATED {
+		self.addDiagnostic(SEVERITY_ERROR, CODE_INVALID_STATUS, filename, r,
+			"Rule %v is replaced by %v but its status is %v",
+			r.Description, r.ReplacedBy, r.Status)
+	}
+}
+
+// Merge the Glob and Globs fields and expand braces so that the rule
+// ends up with a flat list of simple globs in Globs.
+func (self *Compiler) normalizeRule(filename string, r *config.RegistryRule) {
+	r.Root = self.normalizeRoot(filename, r,
 		pathSepRegex.ReplaceAllString(r.Root, "\\"))
 
 	if r.Category == "" {
-		fmt.Printf("Warning: Rule %v is missing category\n", r.Description)
+		self.addDiagnostic(SEVERITY_WARNING, CODE_MISSING_CATEGORY, filename, r,
+			"Rule %v is missing category", r.Description)
 		r.Category = "Misc"
 	}
 
+	self.normalizeTechniques(filename, r)
+	self.normalizeSeverity(filename, r)
+	self.normalizeStatus(filename, r)
+
+	all_globs := r.Globs
+	if r.Glob != "" {
+		all_globs = append([]string{r.Glob}, all_globs...)
+	}
+
 	// Expand the glob expression to support brace expansions
 	globs := []string{}
-	_brace_expansion(r.Glob, &globs)
+	for _, glob := range all_globs {
+		_brace_expansion(normalizeGlob(glob), &globs)
+	}
 
-	res := []config.RegistryRule{}
-	for _, glob := range globs {
-		rule_copy := *r
-		rule_copy.Glob = glob
-		res = append(res, rule_copy)
+	r.Glob = ""
+	r.Globs = nil
+	if r.Query == "" {
+		r.Globs = globs
 	}
-	return res
 }
 
-func (self *Compiler) LoadRules(filename string) error {
+// Load the rules from a rule file and return the diagnostics for this
+// file. An error is returned only if the file could not be loaded at
+// all.
+func (self *Compiler) LoadRules(filename string) (Diagnostics, error) {
+	start := len(self.diagnostics)
+
+	err := self.loadRules(filename)
+	if err != nil {
+		d := newDiagnostic(SEVERITY_ERROR, CODE_LOAD_ERROR, filename, nil,
+			"Unable to load rules: %v", err)
+		d.Line = errorLine(err)
+		self.diagnostics = append(self.diagnostics, d)
+	}
+
+	return self.diagnostics[start:], err
+}
+
+func (self *Compiler) loadRules(filename string) error {
 	fd, err := os.Open(filename)
 	if err != nil {
 		return err
@@ -143,57 +342,121 @@ func (self *Compiler) LoadRules(filename string) error {
 	}
 
 	rules := &config.RuleFile{}
-	err = yaml.UnmarshalStrict(data, rules)
+	invalid_rules, err := self.checkSchema(filename, data, rules)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Loading %v rules from %v\n", len(rules.Rules), filename)
+	positions := findPositions(filename, data)
 
 	// Add preables from rules
-	for _, r := range rules.Rules {
-		for _, r := range self.normalizeRule(&r) {
-
-			if r.Query != "" {
-				self.queries = append(self.queries, r)
-				self.rules = append(self.rules, r)
-				continue
-			}
-
-			key := r.Root + r.Glob
-			existing_rule, pres := self.globs[key]
-			if pres {
-				fmt.Printf("Rule %v by %v has the same glob (%v) as rule %v by %v... skipping this rule!\n",
-					r.Description, r.Author, r.Glob,
-					existing_rule.Description, existing_rule.Author)
-			}
-			self.globs[key] = r
-
-			if len(r.Preamble) > 0 {
-				self.PreambleVerses = append(self.PreambleVerses, r.Preamble...)
-			}
-			self.categories[r.Category] = true
-			parts := strings.Split(r.Description, ":")
-			self.md[parts[0]] = r
-			self.rules = append(self.rules, r)
+	for i, r := range rules.Rules {
+		if invalid_rules[i] {
+			continue
+		}
+
+		r.Source = positions.rule(i)
+
+		if !self.checkId(filename, &r) {
+			continue
+		}
+
+		// Disabled rules keep their Id but are otherwise ignored, so
+		// they are not normalized and raise no diagnostics.
+		if !r.Disabled {
+			self.normalizeRule(filename, &r)
 		}
+		self.ids[r.Id] = r
+
+		if r.Disabled {
+			continue
+		}
+
+		// Tests are kept separately and are not compiled into the
+		// artifact.
+		if len(r.Tests) > 0 {
+			self.tests = append(self.tests, RuleTests{
+				Filename: filename,
+				Rule:     r,
+				Tests:    r.Tests,
+			})
+			r.Tests = nil
+		}
+
+		if r.Query != "" {
+			self.loaded = append(self.loaded, r)
+			continue
+		}
+
+		for j, p := range r.Preamble {
+			self.PreambleVerses = append(self.PreambleVerses, PreambleVerse{
+				Verse:  p,
+				Source: positions.rulePreamble(i, j),
+			})
+		}
+		self.md[r.Id] = r
+		self.loaded = append(self.loaded, r)
 	}
 
 	// Add global preambles
-	self.PreambleVerses = append(self.PreambleVerses, rules.Preamble...)
+	for i, p := range rules.Preamble {
+		self.PreambleVerses = append(self.PreambleVerses, PreambleVerse{
+			Verse:  p,
+			Source: positions.globalPreamble(i),
+		})
+	}
+	self.resolved = false
 	return nil
 }
 
-func (self *Compiler) buildMetadata() string {
-	serialized, _ := json.Marshal(self.rules)
+// Rule files are checked against the schema before they are
+// decoded. This reports every problem with its position instead of
+// rejecting the whole file at the first unknown field. Returns the
+// indexes of the rules with problems, which should be skipped.
+func (self *Compiler) checkSchema(filename string, data []byte,
+	rules *config.RuleFile) (map[int]bool, error) {
+	violations := self.schema.Validate(data)
+	if len(violations) == 0 {
+		return nil, yaml.UnmarshalStrict(data, rules)
+	}
 
-	var b bytes.Buffer
-	gz := gzip.NewWriter(&b)
-	gz.Write(serialized)
-	gz.Close()
-	return base64.StdEncoding.EncodeToString(b.Bytes())
+	invalid_rules := make(map[int]bool)
+	for _, v := range violations {
+		d := newDiagnostic(SEVERITY_ERROR, CODE_SCHEMA_VIOLATION, filename, nil,
+			"%v: %v", v.Path, v.Message)
+		d.Line = v.Line
+		d.Column = v.Column
+		self.diagnostics = append(self.diagnostics, d)
+
+		invalid_rules[v.Rule] = true
+	}
+
+	// The rules without problems can still be decoded.
+	err := yaml.Unmarshal(data, rules)
+	_, is_type_error := err.(*yaml.TypeError)
+	if err != nil && !is_type_error {
+		return nil, err
+	}
+	return invalid_rules, nil
+}
+
+// The source location is only useful for the index so we do not
+// include it in the artifact.
+func withoutSource(rules []config.RegistryRule) []config.RegistryRule {
+	result := make([]config.RegistryRule, 0, len(rules))
+	for _, r := range rules {
+		r.Source = nil
+		result = append(result, r)
+	}
+	return result
+}
+
+func (self *Compiler) buildMetadata(rules []config.RegistryRule) string {
+	return self.compress(self.serialize(withoutSource(rules)))
 }
 
+// The gzip header does not include a modification time or file name
+// so the output only depends on the input.
 func (self *Compiler) compress(in string) string {
 	var b bytes.Buffer
 	gz := gzip.NewWriter(&b)
@@ -205,14 +468,14 @@ func (self *Compiler) compress(in string) string {
 func (self *Compiler) buildPreamble() string {
 	preamble := ordereddict.NewDict()
 
-	for _, p := range self.PreambleVerses {
-		if p == "" {
+	for _, p := range self.preamble {
+		if p.Verse == "" {
 			continue
 		}
 
-		_, exists := preamble.Get(p)
+		_, exists := preamble.Get(p.Verse)
 		if !exists {
-			preamble.Set(p, true)
+			preamble.Set(p.Verse, true)
 		}
 	}
 
@@ -250,33 +513,92 @@ func (self *Compiler) buildCategories() (result []string) {
 	return result
 }
 
+// The normalized rules loaded so far, after resolving conflicts.
+func (self *Compiler) Rules() []config.RegistryRule {
+	self.Resolve()
+	return self.rules
+}
+
+func (self *Compiler) Tests() []RuleTests {
+	return self.tests
+}
+
 func (self *Compiler) GetRules() []byte {
+	self.Resolve()
 	serialized, _ := yaml.Marshal(self.rules)
 	return serialized
 }
 
-func (self *Compiler) Compile() (string, error) {
+// Compile the artifact. All the diagnostics are returned along with
+// an error if any of them are errors.
+func (self *Compiler) Compile() (string, Diagnostics, error) {
+	diagnostics := self.Diagnostics()
+	err := diagnostics.Err()
+	if err != nil {
+		return "", diagnostics, err
+	}
+
+	err = self.ValidateTemplates()
+	if err != nil {
+		return "", diagnostics, err
+	}
+
 	categories := self.buildCategories()
 	parameters := &templateParameters{
-		Name:           "Windows.Registry.Hunter",
-		Metadata:       self.buildMetadata(),
+		Name:           self.Name,
+		Metadata:       self.buildMetadata(self.rules),
 		Rules:          self.rules,
 		Preamble:       self.buildPreamble(),
 		Categories:     categories,
 		CategoriesJSON: self.serialize(categories),
-		QueriesJSON:    self.compress(self.serialize(self.queries)),
-		Time:           time.Now().UTC().Format(time.RFC3339),
+		QueriesJSON:    self.compress(self.serialize(withoutSource(self.queries))),
+		Time:           self.buildTime(),
+		Remapping:      self.remapping(),
+		Data:           self.TemplateData,
+	}
+
+	artifact, err := calculateTemplate(self.artifactTemplate(), parameters)
+	return artifact, diagnostics, err
+}
+
+// Compile all the artifacts - either a single artifact or the split
+// artifacts in Split mode.
+func (self *Compiler) CompileArtifacts() ([]Artifact, Diagnostics, error) {
+	if self.Split {
+		return self.CompileSplit()
 	}
 
-	return calculateTemplate(artifact_template, parameters)
+	artifact, diagnostics, err := self.Compile()
+	if err != nil {
+		return nil, diagnostics, err
+	}
+	return []Artifact{{Name: self.Name, Definition: artifact}}, diagnostics, nil
 }
 
 // A Meta artifact is used to verify the VQL of embedded rules.
 func (self *Compiler) CompileMeta() (string, error) {
+	err := self.Resolve()
+	if err != nil {
+		return "", err
+	}
+
+	err = self.ValidateTemplates()
+	if err != nil {
+		return "", err
+	}
+
+	// The split artifacts keep the preamble in the common artifact.
+	artifact_name := self.Name
+	if self.Split {
+		artifact_name = self.CommonArtifactName()
+	}
+
 	parameters := &templateParameters{
-		Name:  "MetaArtifact",
-		Rules: self.rules,
-		Time:  time.Now().UTC().Format(time.RFC3339),
+		Name:     "MetaArtifact",
+		Artifact: artifact_name,
+		Rules:    self.rules,
+		Time:     self.buildTime(),
+		Data:     self.TemplateData,
 	}
-	return calculateTemplate(artifact_meta_template, parameters)
+	return calculateTemplate(self.metaTemplate(), parameters)
 }
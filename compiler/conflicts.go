@@ -0,0 +1,185 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Velocidex/registry_hunter/config"
+)
+
+const (
+	// The glob was removed from the later rule.
+	RESOLUTION_DROPPED = "dropped"
+
+	// Both rules were kept and their Details are combined into a
+	// single row.
+	RESOLUTION_MERGED = "merged"
+)
+
+// Two rules sharing the same Root and Glob. The artifact looks up the
+// rule metadata by glob so we need to decide what to do with them.
+type Conflict struct {
+	Root string
+	Glob string
+
+	// The rule that was loaded first.
+	Existing config.RegistryRule
+
+	// The rule that was loaded later.
+	Rule config.RegistryRule
+
+	Resolution string
+}
+
+func (self Conflict) String() string {
+	switch self.Resolution {
+	case RESOLUTION_MERGED:
+		return fmt.Sprintf("Rule %v by %v has the same glob (%v) as rule %v by %v... merging both rules",
+			self.Rule.Description, self.Rule.Author, self.Glob,
+			self.Existing.Description, self.Existing.Author)
+
+	default:
+		return fmt.Sprintf("Rule %v by %v has the same glob (%v) as rule %v by %v... dropping the glob from this rule",
+			self.Rule.Description, self.Rule.Author, self.Glob,
+			self.Existing.Description, self.Existing.Author)
+	}
+}
+
+func (self *Compiler) Conflicts() []Conflict {
+	self.Resolve()
+	return self.conflicts
+}
+
+// Resolve conflicts between the selected rules loaded so far. Rules
+// replaced by another rule's Overrides are removed first, then rules
+// sharing the same glob are either merged or the glob is dropped from
+// the later rule. Finally only the preamble verses needed by the
+// remaining rules are kept. In Strict mode conflicts that were not
+// explicitly resolved are errors.
+func (self *Compiler) Resolve() error {
+	if !self.resolved {
+		self.resolve()
+		self.resolved = true
+	}
+
+	return self.resolve_diagnostics.Err()
+}
+
+func (self *Compiler) reportConflict(severity, code string,
+	r *config.RegistryRule, format string, args ...interface{}) {
+	self.resolve_diagnostics = append(self.resolve_diagnostics,
+		newDiagnostic(severity, code, "", r, format, args...))
+}
+
+func (self *Compiler) resolve() {
+	self.rules = nil
+	self.queries = nil
+	self.conflicts = nil
+	self.resolve_diagnostics = nil
+	self.categories = make(map[string]bool)
+
+	conflict_severity := SEVERITY_WARNING
+	if self.Strict {
+		conflict_severity = SEVERITY_ERROR
+	}
+
+	self.checkSelection()
+
+	// Rule Id -> the rule overriding it. Only selected rules replace
+	// other rules.
+	overridden := make(map[string]config.RegistryRule)
+	for _, r := range self.loaded {
+		for _, id := range r.Overrides {
+			_, pres := self.ids[id]
+			if !pres {
+				self.reportConflict(conflict_severity, CODE_UNKNOWN_OVERRIDE, &r,
+					"Rule %v overrides unknown rule Id %v", r.Description, id)
+				continue
+			}
+			if self.Selection.Matches(&r) {
+				overridden[id] = r
+			}
+		}
+	}
+
+	for _, r := range self.loaded {
+		if r.ReplacedBy == "" {
+			continue
+		}
+
+		_, pres := self.ids[r.ReplacedBy]
+		if !pres {
+			self.reportConflict(conflict_severity, CODE_UNKNOWN_REPLACEMENT, &r,
+				"Rule %v is replaced by unknown rule Id %v",
+				r.Description, r.ReplacedBy)
+		}
+	}
+
+	// Root+Glob -> the first rule using it
+	globs := make(map[string]config.RegistryRule)
+
+	for _, r := range self.loaded {
+		if !self.Selection.Matches(&r) {
+			continue
+		}
+
+		by, pres := overridden[r.Id]
+		if pres {
+			self.reportConflict(SEVERITY_INFO, CODE_OVERRIDDEN, &r,
+				"Rule %v is overridden by rule %v", r.Description, by.Description)
+			continue
+		}
+
+		if r.Query != "" {
+			self.queries = append(self.queries, r)
+			self.rules = append(self.rules, r)
+			continue
+		}
+
+		kept := make([]string, 0, len(r.Globs))
+		for _, glob := range r.Globs {
+			// The registry is case insensitive.
+			key := strings.ToLower(r.Root + "\\" + glob)
+			existing_rule, pres := globs[key]
+			if !pres {
+				globs[key] = r
+				kept = append(kept, glob)
+				continue
+			}
+
+			// The same glob repeated within the rule.
+			if existing_rule.Id == r.Id {
+				continue
+			}
+
+			conflict := Conflict{
+				Root:       r.Root,
+				Glob:       glob,
+				Existing:   existing_rule,
+				Rule:       r,
+				Resolution: RESOLUTION_DROPPED,
+			}
+			if self.Merge {
+				conflict.Resolution = RESOLUTION_MERGED
+				kept = append(kept, glob)
+				self.reportConflict(SEVERITY_INFO, CODE_DUPLICATE_GLOB, &r,
+					"%v", conflict)
+			} else {
+				self.reportConflict(conflict_severity, CODE_DUPLICATE_GLOB, &r,
+					"%v", conflict)
+			}
+			self.conflicts = append(self.conflicts, conflict)
+		}
+
+		// Nothing left of this rule.
+		if len(kept) == 0 && len(r.Globs) > 0 {
+			continue
+		}
+
+		r.Globs = kept
+		self.categories[r.Category] = true
+		self.rules = append(self.rules, r)
+	}
+
+	self.resolvePreamble(conflict_severity)
+}
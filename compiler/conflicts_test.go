@@ -0,0 +1,90 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const conflictingRules = `
+Rules:
+- Id: first
+  Description: First
+  Category: Test
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: Select\*
+- Id: second
+  Description: Second
+  Category: Test
+  Root: HKEY_LOCAL_MACHINE\System
+  Globs:
+  - select\*
+  - Setup\*
+- Id: third
+  Description: Third
+  Category: Other
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: Select\*
+  Overrides:
+  - first
+`
+
+func writeTestRules(t *testing.T, rules string) string {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(rules), 0600))
+	return path
+}
+
+func loadTestRules(t *testing.T, rules_compiler *Compiler, rules string) {
+	_, err := rules_compiler.LoadRules(writeTestRules(t, rules))
+	assert.NoError(t, err)
+}
+
+func ruleGlobs(rules_compiler *Compiler) map[string][]string {
+	result := make(map[string][]string)
+	for _, r := range rules_compiler.Rules() {
+		result[r.Id] = r.Globs
+	}
+	return result
+}
+
+func TestConflicts(t *testing.T) {
+	// The overridden rule is removed, but the third rule still
+	// conflicts with the second rule and loses its only glob.
+	rules_compiler := NewCompiler()
+	loadTestRules(t, rules_compiler, conflictingRules)
+	assert.Equal(t, map[string][]string{
+		"second": {"select\\*", "Setup\\*"},
+	}, ruleGlobs(rules_compiler))
+
+	conflicts := rules_compiler.Conflicts()
+	assert.Equal(t, 1, len(conflicts))
+	assert.Equal(t, "third", conflicts[0].Rule.Id)
+	assert.Equal(t, "second", conflicts[0].Existing.Id)
+	assert.Equal(t, RESOLUTION_DROPPED, conflicts[0].Resolution)
+	assert.NoError(t, rules_compiler.Resolve())
+
+	// In Merge mode both rules keep the glob.
+	rules_compiler = NewCompiler()
+	rules_compiler.Merge = true
+	rules_compiler.Strict = true
+	loadTestRules(t, rules_compiler, conflictingRules)
+	assert.Equal(t, map[string][]string{
+		"second": {"select\\*", "Setup\\*"},
+		"third":  {"Select\\*"},
+	}, ruleGlobs(rules_compiler))
+	assert.Equal(t, RESOLUTION_MERGED, rules_compiler.Conflicts()[0].Resolution)
+	assert.NoError(t, rules_compiler.Resolve())
+
+	// Strict mode fails the build.
+	rules_compiler = NewCompiler()
+	rules_compiler.Strict = true
+	loadTestRules(t, rules_compiler, conflictingRules)
+	assert.Error(t, rules_compiler.Resolve())
+
+	_, diagnostics, err := rules_compiler.Compile()
+	assert.Error(t, err)
+	assert.Equal(t, CODE_DUPLICATE_GLOB, diagnostics[len(diagnostics)-1].Code)
+}
@@ -0,0 +1,124 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/Velocidex/registry_hunter/config"
+)
+
+const (
+	SEVERITY_INFO    = "info"
+	SEVERITY_WARNING = "warning"
+	SEVERITY_ERROR   = "error"
+)
+
+// Diagnostic codes
+const (
+	CODE_LOAD_ERROR       = "load-error"
+	CODE_SCHEMA_VIOLATION = "schema-violation"
+	CODE_MISSING_ID       = "missing-id"
+	CODE_INVALID_ID       = "invalid-id"
+	CODE_DUPLICATE_ID     = "duplicate-id"
+	CODE_UNSUPPORTED_ROOT = "unsupported-root"
+	CODE_MISSING_CATEGORY = "missing-category"
+	CODE_DUPLICATE_GLOB   = "duplicate-glob"
+	CODE_UNKNOWN_OVERRIDE = "unknown-override"
+	CODE_OVERRIDDEN       = "overridden"
+
+	CODE_INVALID_TECHNIQUE = "invalid-technique"
+	CODE_UNKNOWN_TECHNIQUE = "unknown-technique"
+
+	CODE_INVALID_SEVERITY = "invalid-severity"
+	CODE_INVALID_KIND     = "invalid-kind"
+
+	CODE_INVALID_STATUS      = "invalid-status"
+	CODE_UNKNOWN_REPLACEMENT = "unknown-replacement"
+)
+
+// A single message about a rule (or a rule file) produced by the
+// compiler.
+type Diagnostic struct {
+	Severity string `json:"Severity"`
+	Code     string `json:"Code"`
+
+	// The rule this diagnostic refers to, if any.
+	RuleId      string `json:"RuleId,omitempty"`
+	Description string `json:"Description,omitempty"`
+
+	File   string `json:"File,omitempty"`
+	Line   int    `json:"Line,omitempty"`
+	Column int    `json:"Column,omitempty"`
+
+	Message string `json:"Message"`
+}
+
+func (self Diagnostic) String() string {
+	location := self.File
+	if location != "" && self.Line > 0 {
+		location = fmt.Sprintf("%v:%v", location, self.Line)
+		if self.Column > 0 {
+			location = fmt.Sprintf("%v:%v", location, self.Column)
+		}
+	}
+	if location != "" {
+		location += ": "
+	}
+
+	return fmt.Sprintf("%v%v: %v [%v]", location, self.Severity,
+		self.Message, self.Code)
+}
+
+type Diagnostics []Diagnostic
+
+func (self Diagnostics) HasErrors() bool {
+	return self.Count(SEVERITY_ERROR) > 0
+}
+
+func (self Diagnostics) Count(severity string) int {
+	count := 0
+	for _, d := range self {
+		if d.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Only return an error if there are any error diagnostics.
+func (self Diagnostics) Err() error {
+	errors := self.Count(SEVERITY_ERROR)
+	if errors == 0 {
+		return nil
+	}
+	return fmt.Errorf("%v errors found in rules", errors)
+}
+
+// All the diagnostics produced while loading and resolving the rules.
+func (self *Compiler) Diagnostics() Diagnostics {
+	self.Resolve()
+
+	result := append(Diagnostics{}, self.diagnostics...)
+	return append(result, self.resolve_diagnostics...)
+}
+
+func newDiagnostic(severity, code, filename string,
+	r *config.RegistryRule, format string, args ...interface{}) Diagnostic {
+	d := Diagnostic{
+		Severity: severity,
+		Code:     code,
+		File:     filename,
+		Message:  fmt.Sprintf(format, args...),
+	}
+
+	if r != nil {
+		d.RuleId = r.Id
+		d.Description = r.Description
+
+		if r.Source != nil {
+			d.File = r.Source.File
+			d.Line = r.Source.Line
+			d.Column = r.Source.Column
+		}
+	}
+	return d
+}
@@ -0,0 +1,86 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const badRules = `
+Rules:
+- Description: No Id
+  Category: Test
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: Select\*
+- Id: "#bad"
+  Description: Invalid Id
+  Category: Test
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: Select\*
+- Id: good
+  Description: Good
+  Root: HKEY_LOCAL_MACHINE\Foo
+  Glob: Select\*
+- Id: good
+  Description: Duplicate
+  Category: Test
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: Select\*
+`
+
+func TestDiagnostics(t *testing.T) {
+	rules_compiler := NewCompiler()
+	loadTestRules(t, rules_compiler, badRules)
+
+	codes := []string{}
+	for _, d := range rules_compiler.Diagnostics() {
+		codes = append(codes, d.Severity+" "+d.Code)
+	}
+	assert.Equal(t, []string{
+		"error missing-id",
+		"error invalid-id",
+		"warning unsupported-root",
+		"warning missing-category",
+		"error duplicate-id",
+	}, codes)
+
+	// Diagnostics point at the start of the rule.
+	d := rules_compiler.Diagnostics()[4]
+	assert.Equal(t, "duplicate-id", d.Code)
+	assert.Equal(t, 16, d.Line)
+	assert.Equal(t, 3, d.Column)
+
+	// Only the good rule is loaded.
+	assert.Equal(t, 1, len(rules_compiler.Rules()))
+
+	_, diagnostics, err := rules_compiler.Compile()
+	assert.Error(t, err)
+	assert.Equal(t, 3, diagnostics.Count(SEVERITY_ERROR))
+
+	// Files that can not be parsed are errors.
+	diagnostics, err = rules_compiler.LoadRules("/does/not/exist.yaml")
+	assert.Error(t, err)
+	assert.Equal(t, CODE_LOAD_ERROR, diagnostics[0].Code)
+
+	// YAML errors include the line.
+	diagnostics, err = rules_compiler.LoadRules(writeTestRules(t, `
+Rules:
+- Id: foo
+  Glob: a: b
+`))
+	assert.Error(t, err)
+	assert.Equal(t, CODE_LOAD_ERROR, diagnostics[0].Code)
+	assert.Equal(t, 4, diagnostics[0].Line)
+
+	// Unknown fields are reported with their position but only the
+	// rule is skipped.
+	diagnostics, err = rules_compiler.LoadRules(writeTestRules(t, `
+Rules:
+- Id: foo
+  Description: Foo
+  Unknown: 1
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, CODE_SCHEMA_VIOLATION, diagnostics[0].Code)
+	assert.Equal(t, 5, diagnostics[0].Line)
+}
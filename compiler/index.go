@@ -6,6 +6,11 @@ import (
 )
 
 func (self *Compiler) WriteIndex(path string) error {
+	err := self.Resolve()
+	if err != nil {
+		return err
+	}
+
 	out_fd, err := os.OpenFile(path,
 		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
@@ -0,0 +1,88 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const lifecycleRules = `
+Rules:
+- Id: run
+  Description: Run keys
+  Category: ASEP
+  Version: 2
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\Run\*
+- Id: run-old
+  Description: Old run keys
+  Category: ASEP
+  ReplacedBy: run
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\Run\**
+- Id: run-once
+  Description: RunOnce keys
+  Category: ASEP
+  Status: Experimental
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\RunOnce\*
+- Id: run-services
+  Description: RunServices keys
+  Category: ASEP
+  Disabled: true
+  DisabledReason: Too noisy
+  Techniques: [T9999]
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\Run\*
+- Id: bad
+  Description: Bad status
+  Category: ASEP
+  Status: stable
+  ReplacedBy: missing
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\RunServicesOnce\*
+`
+
+func TestLifecycle(t *testing.T) {
+	rules_compiler := NewCompiler()
+	rules_compiler.Selection = RuleSelection{
+		RuleIds: []string{"run", "run-old", "run-once", "bad"},
+	}
+	loadTestRules(t, rules_compiler, lifecycleRules)
+
+	codes := []string{}
+	for _, d := range rules_compiler.Diagnostics() {
+		codes = append(codes, d.Severity+" "+d.Code+" "+d.RuleId)
+	}
+	assert.Equal(t, []string{
+		"error invalid-status bad",
+		"warning deprecated-selection run-old",
+		"warning unknown-replacement bad",
+	}, codes)
+
+	// The disabled rule is ignored so it does not conflict with the
+	// first rule, and its unknown technique is not reported.
+	statuses := make(map[string]string)
+	for _, r := range rules_compiler.Rules() {
+		statuses[r.Id] = r.Status + " " + r.Version
+	}
+	assert.Equal(t, map[string]string{
+		"run":      "stable 2",
+		"run-old":  "deprecated ",
+		"run-once": "experimental ",
+		"bad":      "stable ",
+	}, statuses)
+
+	// The Id of the disabled rule is still reserved.
+	diagnostics, err := rules_compiler.LoadRules(writeTestRules(t, `
+Rules:
+- Id: run-services
+  Description: RunServices keys again
+  Category: ASEP
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\RunServices\*
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(diagnostics))
+	assert.Equal(t, CODE_DUPLICATE_ID, diagnostics[0].Code)
+}
@@ -0,0 +1,179 @@
+package compiler
+
+import (
+	"strings"
+
+	"github.com/Velocidex/registry_hunter/config"
+	"github.com/Velocidex/registry_hunter/vql"
+)
+
+// Lint diagnostic codes
+const (
+	CODE_NOT_LAMBDA         = "not-lambda"
+	CODE_VQL_SYNTAX         = "vql-syntax"
+	CODE_UNDEFINED_FUNCTION = "undefined-function"
+	CODE_BAD_GLOB           = "bad-glob"
+)
+
+// Names defined by LET statements in the text.
+func definedNames(text string, names map[string]bool) {
+	tokens, _ := vql.Tokenize(text)
+	for _, d := range vql.Definitions(tokens) {
+		names[d.Name] = true
+	}
+}
+
+// Velociraptor's builtin functions and plugins are all lower case,
+// while the functions defined in the preamble (or the artifact
+// template) start with a capital letter or an underscore. We can only
+// check the latter without a list of builtins.
+func isUserFunction(name string) bool {
+	return name != "" && (name[0] == '_' || (name[0] >= 'A' && name[0] <= 'Z'))
+}
+
+type linter struct {
+	// All the names defined in the preamble or the template.
+	defined map[string]bool
+
+	diagnostics Diagnostics
+}
+
+func (self *linter) report(severity, code string, r *config.RegistryRule,
+	source *config.SourceLocation, format string, args ...interface{}) {
+	d := newDiagnostic(severity, code, "", r, format, args...)
+	if source != nil {
+		d.File = source.File
+		d.Line = source.Line
+		d.Column = source.Column
+	}
+	self.diagnostics = append(self.diagnostics, d)
+}
+
+// Check a VQL snippet. The field is the name of the rule field it
+// came from.
+func (self *linter) checkVQL(r *config.RegistryRule,
+	source *config.SourceLocation, field, text string) {
+	tokens, err := vql.Tokenize(text)
+	if err == nil {
+		err = vql.CheckBrackets(tokens)
+	}
+	if err != nil {
+		self.report(SEVERITY_ERROR, CODE_VQL_SYNTAX, r, source,
+			"%v: %v", field, err)
+		return
+	}
+
+	// Queries may define their own functions.
+	local := make(map[string]bool)
+	for _, d := range vql.Definitions(tokens) {
+		local[d.Name] = true
+	}
+
+	for _, call := range vql.Calls(tokens) {
+		name := strings.Trim(call.Value, "`")
+		if !isUserFunction(name) || self.defined[name] || local[name] {
+			continue
+		}
+
+		self.report(SEVERITY_ERROR, CODE_UNDEFINED_FUNCTION, r, source,
+			"%v: Function %v is not defined in any preamble (line %v column %v)",
+			field, name, call.Line, call.Column)
+	}
+}
+
+func (self *linter) checkLambda(r *config.RegistryRule, field, text string) {
+	if text == "" {
+		return
+	}
+
+	if !vql.IsLambda(text) {
+		self.report(SEVERITY_ERROR, CODE_NOT_LAMBDA, r, r.Source,
+			"%v must be a lambda starting with x=>", field)
+	}
+	self.checkVQL(r, r.Source, field, text)
+}
+
+// Check for glob characters the registry accessor can not match.
+func (self *linter) checkGlob(r *config.RegistryRule, glob string) {
+	for _, c := range glob {
+		if c < 0x20 || c == 0x7f {
+			self.report(SEVERITY_ERROR, CODE_BAD_GLOB, r, r.Source,
+				"Glob %q contains a control character", glob)
+			return
+		}
+	}
+
+	// Brace expansion already removed balanced braces.
+	if strings.ContainsAny(glob, "{}") {
+		self.report(SEVERITY_ERROR, CODE_BAD_GLOB, r, r.Source,
+			"Glob %q contains unbalanced braces - use ? to match a brace", glob)
+	}
+
+	// Quotes within quoted components are escaped.
+	if strings.Count(strings.ReplaceAll(glob, "\\\"", ""), "\"")%2 != 0 {
+		self.report(SEVERITY_ERROR, CODE_BAD_GLOB, r, r.Source,
+			"Glob %q contains unbalanced quotes", glob)
+	}
+
+	depth := 0
+	for _, c := range glob {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		if depth < 0 || depth > 1 {
+			break
+		}
+	}
+	if depth != 0 {
+		self.report(SEVERITY_ERROR, CODE_BAD_GLOB, r, r.Source,
+			"Glob %q contains unbalanced character class brackets", glob)
+	}
+
+	if strings.Contains(glob, "\\\\") || strings.HasSuffix(glob, "\\") {
+		self.report(SEVERITY_WARNING, CODE_BAD_GLOB, r, r.Source,
+			"Glob %q contains an empty path component", glob)
+	}
+}
+
+// Check the VQL embedded in all the loaded rules and preambles. This
+// runs offline so it can only catch simple problems - the meta
+// artifact should still be verified with Velociraptor.
+func (self *Compiler) Lint() Diagnostics {
+	l := &linter{
+		defined: make(map[string]bool),
+	}
+
+	definedNames(self.artifactTemplate(), l.defined)
+	definedNames(artifact_sections, l.defined)
+
+	seen := make(map[string]bool)
+	for _, p := range self.PreambleVerses {
+		definedNames(p.Verse, l.defined)
+	}
+
+	for _, p := range self.PreambleVerses {
+		if seen[p.Verse] {
+			continue
+		}
+		seen[p.Verse] = true
+		l.checkVQL(nil, p.Source, "Preamble", p.Verse)
+	}
+
+	for _, r := range self.loaded {
+		l.checkLambda(&r, "Details", r.Details)
+		l.checkLambda(&r, "Filter", r.Filter)
+
+		if r.Query != "" {
+			l.checkVQL(&r, r.Source, "Query", r.Query)
+		}
+
+		for _, glob := range r.Globs {
+			l.checkGlob(&r, glob)
+		}
+	}
+
+	return l.diagnostics
+}
@@ -0,0 +1,57 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const lintRules = `
+Preamble:
+- LET Defined(OSPath) = dict(a={ SELECT * FROM info() })
+- LET Broken(OSPath) = dict(a={ SELECT * FROM info() )
+
+Rules:
+- Id: good
+  Category: Test
+  Root: HKEY_USERS
+  Glob: '*\Software\{Run,RunOnce}\*'
+  Details: x=>Defined(OSPath=x.OSPath)
+  Filter: x=>GetDetails(OSPath=x.OSPath)
+- Id: bad-lambda
+  Category: Test
+  Root: HKEY_USERS
+  Glob: '*\Software\Foo'
+  Details: Defined(OSPath=x.OSPath)
+- Id: undefined
+  Category: Test
+  Root: HKEY_USERS
+  Glob: '*\Software\"Foo\"Bar"'
+  Query: |
+    LET Local(X) = X
+    SELECT Local(X=1), Undefined(X=2), format(format="%v", args=1)
+    FROM scope()
+- Id: bad-glob
+  Category: Test
+  Root: HKEY_USERS
+  Glob: '*\Software\{Foo\[ab"Bar'
+`
+
+func TestLint(t *testing.T) {
+	rules_compiler := NewCompiler()
+	loadTestRules(t, rules_compiler, lintRules)
+
+	messages := []string{}
+	for _, d := range rules_compiler.Lint() {
+		messages = append(messages, d.Code+" "+d.RuleId+" "+d.Message)
+	}
+
+	assert.Equal(t, []string{
+		`vql-syntax  Preamble: Unexpected ")" to close "{" at line 1 column 29 at line 1 column 52`,
+		`not-lambda bad-lambda Details must be a lambda starting with x=>`,
+		`undefined-function undefined Query: Function Undefined is not defined in any preamble (line 2 column 20)`,
+		`bad-glob bad-glob Glob "*\\Software\\{Foo\\[ab\"Bar" contains unbalanced braces - use ? to match a brace`,
+		`bad-glob bad-glob Glob "*\\Software\\{Foo\\[ab\"Bar" contains unbalanced quotes`,
+		`bad-glob bad-glob Glob "*\\Software\\{Foo\\[ab\"Bar" contains unbalanced character class brackets`,
+	}, messages)
+}
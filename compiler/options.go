@@ -0,0 +1,99 @@
+package compiler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Velocidex/registry_hunter/config"
+)
+
+// The fields every artifact template must use, otherwise the
+// artifact would not contain the rules.
+var requiredTemplateFields = []string{"Metadata", "QueriesJSON", "Preamble"}
+
+// Options controlling how the artifacts are built.
+type CompilerOptions struct {
+	// In strict mode unresolved conflicts fail the build.
+	Strict bool
+
+	// Rules sharing the same glob are all kept, rather than dropping
+	// the glob from the later rule. Each match produces a single row
+	// attributed to the first rule, with the Details of every rule
+	// whose Filter matches.
+	Merge bool
+
+	// Only these rules are built into the artifact.
+	Selection RuleSelection
+
+	// The name of the compiled artifact.
+	Name string
+
+	// Build one artifact per category (see CompileSplit)
+	Split bool
+
+	// Templates replacing the embedded template.yaml and
+	// meta_template.yaml. They may include the sections defined in
+	// template_sections.yaml.
+	Template     string
+	MetaTemplate string
+
+	// Extra data available to the templates as .Data (e.g. the
+	// organisation name or parameter defaults).
+	TemplateData map[string]interface{}
+
+	// The build time stamped into the artifacts. Defaults to the
+	// current time - set it for reproducible builds.
+	BuildTime time.Time
+
+	// Where the hives are mounted (defaults to config.DefaultMounts)
+	Mounts *config.Mounts
+}
+
+func DefaultCompilerOptions() CompilerOptions {
+	return CompilerOptions{
+		Name:   DEFAULT_ARTIFACT_NAME,
+		Mounts: config.DefaultMounts(),
+	}
+}
+
+func (self *Compiler) buildTime() string {
+	build_time := self.BuildTime
+	if build_time.IsZero() {
+		build_time = time.Now()
+	}
+	return build_time.UTC().Format(time.RFC3339)
+}
+
+func (self *Compiler) artifactTemplate() string {
+	if self.Template != "" {
+		return self.Template
+	}
+	return artifact_template
+}
+
+func (self *Compiler) metaTemplate() string {
+	if self.MetaTemplate != "" {
+		return self.MetaTemplate
+	}
+	return artifact_meta_template
+}
+
+// Check the custom templates before using them.
+func (self *Compiler) ValidateTemplates() error {
+	if self.Template != "" {
+		if self.Split {
+			return errors.New("A custom template can not be used to build split artifacts")
+		}
+
+		err := validateTemplate(self.Template, requiredTemplateFields...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if self.MetaTemplate != "" {
+		return validateTemplate(self.MetaTemplate, "Rules")
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package compiler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const customTemplate = `name: {{ .Name }}
+description: Built for {{ .Data.Org }}
+
+parameters:
+{{ template "rule_parameters" . }}
+
+export: |
+    LET _MD <= "{{ .Metadata }}"
+    LET FullQueries <= "{{ .QueriesJSON }}"
+{{ .Preamble }}
+`
+
+func TestCustomTemplates(t *testing.T) {
+	options := DefaultCompilerOptions()
+	options.Template = customTemplate
+	options.MetaTemplate = `{{ range .Rules }}{{ .Id }} {{ end }}`
+	options.TemplateData = map[string]interface{}{"Org": "Acme"}
+
+	rules_compiler := NewCompilerWithOptions(options)
+	loadTestRules(t, rules_compiler, selectionRules)
+
+	artifact, _, err := rules_compiler.Compile()
+	assert.NoError(t, err)
+	assert.Contains(t, artifact, "description: Built for Acme\n")
+	assert.Contains(t, artifact, "- name: RuleFilter\n")
+	assert.Contains(t, artifact, "LET ParseRun(x)")
+
+	meta, err := rules_compiler.CompileMeta()
+	assert.NoError(t, err)
+	assert.Equal(t, "run userassist new-services ", meta)
+
+	// Templates must use the metadata and preamble.
+	options.Template = `name: {{ .Name }}
+export: |
+    {{ template "export_metadata" . }}
+`
+	rules_compiler = NewCompilerWithOptions(options)
+	loadTestRules(t, rules_compiler, selectionRules)
+	_, _, err = rules_compiler.Compile()
+	assert.EqualError(t, err,
+		"Template does not use the required fields .QueriesJSON, .Preamble")
+
+	options.Template = `name: {{ .Name`
+	rules_compiler = NewCompilerWithOptions(options)
+	assert.Error(t, rules_compiler.ValidateTemplates())
+
+	// Custom templates can not be used with split artifacts.
+	options.Template = customTemplate
+	options.Split = true
+	rules_compiler = NewCompilerWithOptions(options)
+	assert.Error(t, rules_compiler.ValidateTemplates())
+
+	// The built in templates are valid.
+	assert.NoError(t, validateTemplate(artifact_template, requiredTemplateFields...))
+	assert.NoError(t, validateTemplate(artifact_meta_template, "Rules"))
+}
+
+func TestReproducible(t *testing.T) {
+	build := func() []Artifact {
+		options := DefaultCompilerOptions()
+		options.Split = true
+		options.BuildTime = time.Unix(1700000000, 0)
+
+		rules_compiler := NewCompilerWithOptions(options)
+		loadTestRules(t, rules_compiler, selectionRules)
+
+		artifacts, _, err := rules_compiler.CompileArtifacts()
+		assert.NoError(t, err)
+		return artifacts
+	}
+
+	first := build()
+	time.Sleep(time.Second)
+	assert.Equal(t, first, build())
+	assert.Contains(t, first[0].Definition, "Build time: 2023-11-14T22:13:20Z\n")
+}
@@ -0,0 +1,212 @@
+package compiler
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Velocidex/registry_hunter/vql"
+)
+
+// Preamble diagnostic codes
+const (
+	CODE_UNUSED_PREAMBLE    = "unused-preamble"
+	CODE_DUPLICATE_PREAMBLE = "duplicate-preamble"
+)
+
+var (
+	identifierRegex = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+)
+
+// A preamble verse after analysis.
+type preambleNode struct {
+	verse PreambleVerse
+
+	// The verse text without comments or whitespace. Verses which
+	// only differ in formatting are the same.
+	key string
+
+	// Names defined by LET in this verse.
+	defines []string
+
+	// Lower cased names referenced by this verse.
+	references map[string]bool
+}
+
+// Collect all the identifiers in the VQL that might refer to a
+// preamble definition. This errs on the side of including too much:
+// field names and identifiers inside strings (which might be lambdas
+// or queries) are included too.
+func collectReferences(tokens []*vql.Token, refs map[string]bool) {
+	for i, t := range tokens {
+		switch t.Type {
+		case vql.TOKEN_IDENT:
+			// The name being defined is not a reference.
+			if i > 0 && tokens[i-1].Is("LET") {
+				continue
+			}
+			refs[strings.ToLower(strings.Trim(t.Value, "`"))] = true
+
+		case vql.TOKEN_STRING:
+			for _, word := range identifierRegex.FindAllString(t.Value, -1) {
+				refs[strings.ToLower(word)] = true
+			}
+		}
+	}
+}
+
+func referencesIn(text string, refs map[string]bool) {
+	tokens, err := vql.Tokenize(text)
+	if err != nil {
+		// Fall back to anything that looks like an identifier.
+		for _, word := range identifierRegex.FindAllString(text, -1) {
+			refs[strings.ToLower(word)] = true
+		}
+		return
+	}
+	collectReferences(tokens, refs)
+}
+
+func analyzeVerse(verse PreambleVerse) *preambleNode {
+	result := &preambleNode{
+		verse:      verse,
+		key:        verse.Verse,
+		references: make(map[string]bool),
+	}
+
+	tokens, err := vql.Tokenize(verse.Verse)
+	if err != nil {
+		return result
+	}
+
+	values := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		values = append(values, t.Value)
+	}
+	result.key = strings.Join(values, " ")
+
+	for _, d := range vql.Definitions(tokens) {
+		// LET _ is only evaluated for its side effects.
+		if d.Name != "_" {
+			result.defines = append(result.defines, d.Name)
+		}
+	}
+	collectReferences(tokens, result.references)
+
+	return result
+}
+
+func (self *Compiler) reportVerse(severity, code string, verse PreambleVerse,
+	format string, args ...interface{}) {
+	d := newDiagnostic(severity, code, "", nil, format, args...)
+	if verse.Source != nil {
+		d.File = verse.Source.File
+		d.Line = verse.Source.Line
+		d.Column = verse.Source.Column
+	}
+	self.resolve_diagnostics = append(self.resolve_diagnostics, d)
+}
+
+// Select only the preamble verses that are needed by the rules (or
+// by other needed verses). Verses that do not define anything are
+// always included since we can not tell who needs them.
+func (self *Compiler) resolvePreamble(duplicate_severity string) {
+	self.preamble = nil
+
+	nodes := []*preambleNode{}
+	seen := make(map[string]bool)
+	for _, verse := range self.PreambleVerses {
+		if strings.TrimSpace(verse.Verse) == "" {
+			continue
+		}
+
+		node := analyzeVerse(verse)
+		if seen[node.key] {
+			continue
+		}
+		seen[node.key] = true
+		nodes = append(nodes, node)
+	}
+
+	// Lower cased name -> All verses defining it
+	definitions := make(map[string][]*preambleNode)
+	display_names := make(map[string]string)
+	for _, node := range nodes {
+		for _, name := range node.defines {
+			key := strings.ToLower(name)
+			definitions[key] = append(definitions[key], node)
+			if display_names[key] == "" {
+				display_names[key] = name
+			}
+		}
+	}
+
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, key := range names {
+		defs := definitions[key]
+		for _, other := range defs[1:] {
+			self.reportVerse(duplicate_severity, CODE_DUPLICATE_PREAMBLE,
+				other.verse, "LET %v is defined differently by another preamble verse at %v",
+				display_names[key], defs[0].verse.Source)
+		}
+	}
+
+	// Start with everything the artifact template and rules refer to.
+	pending := make(map[string]bool)
+	referencesIn(self.artifactTemplate(), pending)
+	referencesIn(artifact_sections, pending)
+	for _, r := range self.rules {
+		referencesIn(r.Details, pending)
+		referencesIn(r.Filter, pending)
+		referencesIn(r.Query, pending)
+	}
+
+	reachable := make(map[*preambleNode]bool)
+	for _, node := range nodes {
+		if len(node.defines) == 0 {
+			reachable[node] = true
+			for ref := range node.references {
+				pending[ref] = true
+			}
+		}
+	}
+
+	visited := make(map[string]bool)
+	for len(pending) > 0 {
+		for name := range pending {
+			delete(pending, name)
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+
+			for _, node := range definitions[name] {
+				if reachable[node] {
+					continue
+				}
+				reachable[node] = true
+				for ref := range node.references {
+					if !visited[ref] {
+						pending[ref] = true
+					}
+				}
+			}
+		}
+	}
+
+	for _, node := range nodes {
+		if reachable[node] {
+			self.preamble = append(self.preamble, node.verse)
+			continue
+		}
+
+		self.reportVerse(SEVERITY_INFO, CODE_UNUSED_PREAMBLE, node.verse,
+			"Preamble verse defining %v is not used by any rule",
+			strings.Join(node.defines, ", "))
+	}
+}
@@ -0,0 +1,86 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const preambleRules = `
+Preamble:
+- |
+  LET Used(OSPath) = Helper(X=OSPath)
+- |
+  LET Helper(X) = format(format="%v", args=X)
+- |
+  LET Unused(OSPath) = stat(filename=OSPath)
+- |
+  LET Lookup <= dict(a='Helper')
+- |
+  LET Twice(X) = X
+- |
+  LET Twice(X) = X + 1
+Rules:
+- Id: first
+  Description: First
+  Category: Test
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: Select\*
+  Details: x=>Used(OSPath=x.OSPath)
+- Id: second
+  Description: Second
+  Category: Test
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: Setup\*
+  Filter: x=>Twice(X=x.Data)
+  Preamble:
+  - |
+    -- Always included
+    LET _ = log(message="Loaded")
+  - |
+    LET Used(OSPath) = Helper(X=OSPath)
+`
+
+func TestPreamble(t *testing.T) {
+	rules_compiler := NewCompiler()
+	loadTestRules(t, rules_compiler, preambleRules)
+
+	diagnostics := rules_compiler.Diagnostics()
+
+	verses := []string{}
+	for _, v := range rules_compiler.preamble {
+		verses = append(verses, strings.TrimSpace(v.Verse))
+	}
+
+	// Only reachable verses are kept, once each and in order.
+	assert.Equal(t, []string{
+		"-- Always included\nLET _ = log(message=\"Loaded\")",
+		`LET Used(OSPath) = Helper(X=OSPath)`,
+		`LET Helper(X) = format(format="%v", args=X)`,
+		`LET Twice(X) = X`,
+		`LET Twice(X) = X + 1`,
+	}, verses)
+
+	messages := []string{}
+	for _, d := range diagnostics {
+		switch d.Code {
+		case CODE_UNUSED_PREAMBLE, CODE_DUPLICATE_PREAMBLE:
+			messages = append(messages, d.String())
+		}
+	}
+
+	path := rules_compiler.PreambleVerses[0].Source.File
+	assert.Equal(t, []string{
+		path + ":13:3: warning: LET Twice is defined differently by another preamble verse at " +
+			path + ":11:3 [duplicate-preamble]",
+		path + ":7:3: info: Preamble verse defining Unused is not used by any rule [unused-preamble]",
+		path + ":9:3: info: Preamble verse defining Lookup is not used by any rule [unused-preamble]",
+	}, messages)
+
+	// Duplicate definitions fail the build in strict mode.
+	rules_compiler = NewCompiler()
+	rules_compiler.Strict = true
+	loadTestRules(t, rules_compiler, preambleRules)
+	assert.Error(t, rules_compiler.Resolve())
+}
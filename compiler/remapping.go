@@ -0,0 +1,285 @@
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Velocidex/registry_hunter/config"
+)
+
+// The remapping VQL (the export_remapping template section) is
+// generated from the mounts. All the fields are VQL expressions.
+type remapParameters struct {
+	Strategies      []remapStrategy
+	DefaultStrategy string
+
+	// The PathTO* parameters and their defaults
+	Hives []remapHive
+
+	UsersPath string
+	Mounts    []remapMount
+
+	// Where the SID of each user is found.
+	ProfileListHive string
+	ProfileListGlob string
+
+	// A regex matching the roots of the user hives.
+	UserRoots string
+
+	// The hive and the glob of the values selecting the control
+	// sets. ControlSetRoot matches the root of the hive which has
+	// ControlSetDepth components below the prefix of a Source.
+	ControlSetsHive string
+	ControlSetsGlob string
+	ControlSetRoot  string
+	ControlSetDepth int
+
+	// The hive files uploaded by AlsoUploadHives
+	Uploads []string
+
+	// The mounts of each swept shadow copy. The hive paths are
+	// relative to its Device and the registry paths below its
+	// Prefix which has ShadowCopyDepth components.
+	ShadowCopyPrefix      string
+	ShadowCopyDepth       int
+	ShadowCopyMounts      []remapMount
+	ShadowCopyControlSets string
+
+	// The Raw Hives mounts repeated below the Prefix of each variant
+	// of the hives (e.g. the hives with their transaction logs
+	// replayed). RawHivesStrategy matches the strategy name.
+	VariantMounts    []remapMount
+	RawHivesStrategy string
+}
+
+type remapStrategy struct {
+	Name        string
+	Description string
+	Condition   string
+
+	// The arrays of mappings added together for this strategy.
+	Mappings []string
+}
+
+type remapHive struct {
+	Parameter string
+	Path      string
+}
+
+type remapMount struct {
+	// The VQL variable holding the mapping
+	Name string
+
+	// For user hives, the glob relative to the users directory,
+	// the directory and the profile folder name.
+	Glob      string
+	UsersRoot string
+	User      string
+
+	HivePath     string
+	RegistryPath string
+	KeyPath      string
+	Accessor     string
+	Description  string
+
+	// The variant of the hive file which is mounted (see _HiveFile).
+	// Empty to mount the file at HivePath itself.
+	Variant string
+}
+
+// Quote a string for VQL.
+func vqlString(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	return "\"" + strings.ReplaceAll(s, "\"", "\\\"") + "\""
+}
+
+// Build a VQL string expression replacing the placeholders (e.g.
+// %USER%) with VQL expressions.
+func vqlExpand(s string, placeholders map[string]string) string {
+	parts := []string{}
+	last := 0
+	for _, idx := range config.PlaceholderRegex.FindAllStringIndex(s, -1) {
+		if idx[0] > last {
+			parts = append(parts, vqlString(s[last:idx[0]]))
+		}
+		parts = append(parts, placeholders[s[idx[0]:idx[1]]])
+		last = idx[1]
+	}
+
+	if last < len(s) || last == 0 {
+		parts = append(parts, vqlString(s[last:]))
+	}
+	return strings.Join(parts, " + ")
+}
+
+func (self *Compiler) remapping() *remapParameters {
+	result := &remapParameters{
+		DefaultStrategy:  vqlString(self.Mounts.DefaultStrategy),
+		UsersPath:        vqlString(self.Mounts.UsersPath),
+		ShadowCopyPrefix: vqlString(self.Mounts.ShadowCopies.Prefix + "\\"),
+		ShadowCopyDepth: len(strings.Split(
+			self.Mounts.ShadowCopies.Prefix, "\\")) + 1,
+		RawHivesStrategy: vqlString(
+			"^" + regexp.QuoteMeta(config.RAW_HIVES_STRATEGY) + "$"),
+	}
+
+	// The profiles are read from the raw hive which is always
+	// accessible.
+	profile_hive, err := self.Mounts.Hive(self.Mounts.ProfileList.Hive)
+	if err == nil {
+		result.ProfileListHive = profile_hive.Parameter
+		result.ProfileListGlob = vqlString("/" + strings.ReplaceAll(
+			self.Mounts.ProfileList.Key, "\\", "/") + "/*/ProfileImagePath")
+	}
+
+	control_sets_hive, err := self.Mounts.Hive(self.Mounts.ControlSets.Hive)
+	if err == nil {
+		result.ControlSetsHive = control_sets_hive.Parameter
+		result.ControlSetsGlob = vqlString("/" + strings.ReplaceAll(
+			self.Mounts.ControlSets.Key, "\\", "/") + "/*")
+		result.ShadowCopyControlSets = "OSPath + " + vqlString(control_sets_hive.Path)
+
+		conditions := []string{}
+		components := strings.Split(control_sets_hive.Root, "\\")
+		for i, c := range components {
+			depth := "Source.Depth"
+			if i > 0 {
+				depth += fmt.Sprintf(" + %d", i)
+			}
+			conditions = append(conditions, fmt.Sprintf("OSPath.Components[%v] =~ %v",
+				depth, vqlString("^"+regexp.QuoteMeta(c)+"$")))
+		}
+		result.ControlSetRoot = strings.Join(conditions, " AND ")
+		result.ControlSetDepth = len(components)
+	}
+
+	user_roots := []string{}
+	for _, root := range self.Mounts.UserRoots() {
+		user_roots = append(user_roots, regexp.QuoteMeta(root))
+	}
+	result.UserRoots = vqlString("^(" + strings.Join(user_roots, "|") + ")$")
+
+	// Mappings used by each strategy
+	mappings := make(map[string][]string)
+
+	for _, hive := range self.Mounts.Hives {
+		if hive.Path == "" {
+			continue
+		}
+
+		if hive.PerUser {
+			result.Uploads = append(result.Uploads,
+				"PathTOUsers + "+vqlString(hive.Glob()+"*"))
+		} else {
+			result.Hives = append(result.Hives, remapHive{
+				Parameter: hive.Parameter,
+				Path:      vqlString(hive.Path),
+			})
+			// Also upload the transaction logs so the hive can be
+			// recovered offline (see reghunter replay)
+			result.Uploads = append(result.Uploads, hive.Parameter,
+				fmt.Sprintf(`%v.Dirname + (%v.Basename + ".LOG*")`,
+					hive.Parameter, hive.Parameter))
+		}
+
+		for idx, m := range hive.Mounts {
+			mount := newRemapMount(&hive, m, idx, hive.Parameter, "PathTOUsers", "")
+			mount.Variant = "_LiveVariant"
+			result.Mounts = append(result.Mounts, mount)
+
+			if m.Uses(config.RAW_HIVES_STRATEGY) &&
+				m.Accessor == config.DEFAULT_MOUNT_ACCESSOR {
+				variant := newRemapMount(&hive, m, idx, hive.Parameter,
+					"PathTOUsers", "Prefix + ")
+				variant.Variant = "Variant"
+				result.VariantMounts = append(result.VariantMounts, variant)
+			}
+
+			mapping := mount.Name
+			if hive.PerUser {
+				mapping += ".Mapping"
+			}
+
+			for _, s := range m.Strategies {
+				mappings[s] = append(mappings[s], mapping)
+			}
+		}
+
+		// The same hive inside the shadow copy mounted at Device.
+		for idx, m := range hive.ShadowCopyMounts(self.Mounts.ShadowCopies) {
+			result.ShadowCopyMounts = append(result.ShadowCopyMounts,
+				newRemapMount(&hive, m, idx,
+					"Device + "+vqlString(hive.Path),
+					"Device + "+vqlString(self.Mounts.UsersPath), "Prefix + "))
+		}
+	}
+
+	for _, s := range self.Mounts.Strategies {
+		strategy := remapStrategy{
+			Name:        s.Name,
+			Description: s.Description,
+			Condition:   vqlString("^" + regexp.QuoteMeta(s.Name) + "$"),
+		}
+		if s.API {
+			strategy.Mappings = append(strategy.Mappings, "_api_remapping")
+		}
+		strategy.Mappings = append(strategy.Mappings, mappings[s.Name]...)
+
+		// Shadow copies are swept whatever the strategy. The hive
+		// variants are only mounted with the Raw Hives strategy (see
+		// TransactionLogs).
+		strategy.Mappings = append(strategy.Mappings, "_map_shadow_copies.Mapping")
+		if s.Name == config.RAW_HIVES_STRATEGY {
+			strategy.Mappings = append(strategy.Mappings, "_map_hive_variants.Mapping")
+		}
+		result.Strategies = append(result.Strategies, strategy)
+	}
+
+	return result
+}
+
+// Build the mount of a hive file. hive_path and users_root are VQL
+// expressions and prefix is prepended to the registry path.
+func newRemapMount(hive *config.Hive, m config.Mount, idx int,
+	hive_path, users_root, prefix string) remapMount {
+	mount := remapMount{
+		Name:         "_map_" + strings.ToLower(hive.Name),
+		HivePath:     hive_path,
+		RegistryPath: prefix + vqlString(m.RegistryPath),
+		KeyPath:      vqlString(m.KeyPath),
+		Accessor:     vqlString(m.Accessor),
+		Description:  vqlString(m.Description),
+	}
+
+	// The control set is read from the hive when it is mounted.
+	if m.ControlSet != "" {
+		mount.KeyPath = fmt.Sprintf(`"/" + _SelectedControlSet(HivePath=%v, Name=%v)`,
+			hive_path, vqlString(m.ControlSet))
+	}
+
+	if len(hive.Mounts) > 1 {
+		mount.Name += fmt.Sprintf("_%d", idx)
+	}
+
+	if !hive.PerUser {
+		return mount
+	}
+
+	// Placeholders are replaced by the components of the hive's
+	// OSPath they match, except the user which may be the SID (see
+	// _UserKeys)
+	placeholders := make(map[string]string)
+	for p, idx := range hive.Placeholders() {
+		placeholders[p] = fmt.Sprintf("OSPath[%d]", idx)
+	}
+	mount.User = placeholders[config.USER_PLACEHOLDER]
+	placeholders[config.USER_PLACEHOLDER] = "UserKey"
+
+	mount.Glob = vqlString(hive.Glob())
+	mount.UsersRoot = users_root
+	mount.HivePath = "OSPath"
+	mount.RegistryPath = prefix + vqlExpand(m.RegistryPath, placeholders)
+	mount.Description = vqlExpand(m.Description, placeholders)
+	return mount
+}
@@ -0,0 +1,160 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Velocidex/registry_hunter/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMounts = `
+Strategies:
+- Name: API
+  API: true
+- Name: Raw Hives
+DefaultStrategy: Raw Hives
+UsersPath: Users/
+ProfileList:
+  Hive: SYSTEM
+  Key: ProfileList
+ControlSets:
+  Hive: SYSTEM
+  Key: Select
+ShadowCopies:
+  Prefix: Snapshots
+  Strategy: Raw Hives
+Hives:
+- Name: SYSTEM
+  Parameter: PathTOSystem
+  Path: Windows/System32/Config/System
+  Root: HKEY_LOCAL_MACHINE\System
+  Mounts:
+  - Description: Map System hive
+    Strategies: [Raw Hives]
+  - Description: Map CurrentControlSet
+    RegistryPath: HKEY_LOCAL_MACHINE\System\CurrentControlSet
+    ControlSet: Current
+    Strategies: [Raw Hives]
+- Name: SETTINGS
+  PerUser: true
+  Path: "%USER%/AppData/Local/Packages/%PACKAGE%/Settings.dat"
+  Root: Settings\%USER%\%PACKAGE%
+  Mounts:
+  - Description: Map Settings.dat of %USER%
+    Strategies: [API, Raw Hives]
+`
+
+const remappingRules = `
+Rules:
+- Id: services
+  Description: Services
+  Category: ASEP
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: ControlSet001\Services\*
+- Id: run
+  Description: Run keys
+  Category: ASEP
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\Run\*
+`
+
+func TestRemapping(t *testing.T) {
+	assert.Equal(t, []string{"", "/",
+		"HKEY_LOCAL_MACHINE\\System",
+		"HKEY_LOCAL_MACHINE\\Software",
+		"HKEY_LOCAL_MACHINE\\Security",
+		"SAM", "Amcache", "HKEY_USERS", "UWPSettings",
+		"HKEY_USERS\\.DEFAULT",
+		"HKEY_LOCAL_MACHINE\\COMPONENTS",
+		"HKEY_LOCAL_MACHINE\\DRIVERS",
+		"HKEY_LOCAL_MACHINE\\BBI",
+		"HKEY_LOCAL_MACHINE\\ELAM",
+		"Syscache",
+		"HKEY_LOCAL_MACHINE\\BCD00000000",
+	}, NewCompiler().allowedRoots())
+
+	mounts, err := config.LoadMounts([]byte(testMounts))
+	assert.NoError(t, err)
+
+	options := DefaultCompilerOptions()
+	options.Mounts = mounts
+	rules_compiler := NewCompilerWithOptions(options)
+	loadTestRules(t, rules_compiler, remappingRules)
+
+	// Only the hives in the mounts may be used.
+	diagnostics := rules_compiler.Diagnostics()
+	assert.Equal(t, 1, len(diagnostics))
+	assert.Equal(t, CODE_UNSUPPORTED_ROOT, diagnostics[0].Code)
+
+	artifact, _, err := rules_compiler.Compile()
+	assert.NoError(t, err)
+
+	for _, expected := range []string{
+		`LET PathTOSystem <= S.PathTOSystem || RootDrive + "Windows/System32/Config/System"`,
+		`RegistryPath="Settings\\" + UserKey + "\\" + OSPath[-2],`,
+		`Description="Map Settings.dat of " + UserKey) AS Mapping`,
+		`SELECT OSPath, _UserKeys(Username=OSPath[-6]) AS UserKey
+      FROM glob(globs="*/AppData/Local/Packages/*/Settings.dat", root=PathTOUsers)`,
+		`globs="/ProfileList/*/ProfileImagePath"`,
+		`root=pathspec(DelegatePath=PathTOSystem,`,
+		`=~ "^(Settings)$"`,
+		`LET RemappingStrategy <= S.RemappingStrategy || "Raw Hives"`,
+		`PathTOUsers + "*/AppData/Local/Packages/*/Settings.dat*"`,
+		`if(condition=RemappingStrategy =~ "^API$",
+       then=_api_remapping +
+            _map_settings.Mapping +
+            _map_shadow_copies.Mapping +
+            _log_array(Message="Using API Mapping"),`,
+		`if(condition=RemappingStrategy =~ "^Raw Hives$",
+       then=_map_system_0 +
+            _map_system_1 +
+            _map_settings.Mapping +
+            _map_shadow_copies.Mapping +
+            _map_hive_variants.Mapping +
+            _log_array(Message="Using Raw Hives Mapping"),`,
+
+		// The live hives may be replayed (see TransactionLogs) and
+		// the Raw Hives mounts are repeated for each variant.
+		`HivePath=_HiveFile(HivePath=PathTOSystem, Variant=_LiveVariant).Path,`,
+		`HivePath=_HiveFile(HivePath=OSPath, Variant=Variant).Path,
+      RegistryPath=Prefix + "Settings\\" + UserKey + "\\" + OSPath[-2],`,
+		// Nothing is mounted for a variant without a hive file (e.g.
+		// a hive with nothing deleted).
+		`WHERE _HiveFile(HivePath=PathTOSystem, Variant=Variant).Path`,
+
+		// The Raw Hives mounts are repeated for each shadow copy.
+		`"Snapshots\\" + Data.ID + "\\" AS Prefix,
+           2 AS Depth`,
+		// The control sets are read from the raw hive.
+		`RegMountPoint="/" + _SelectedControlSet(HivePath=PathTOSystem, Name="Current"),`,
+		`globs="/Select/*"`,
+		`condition=OSPath.Components[Source.Depth] =~ "^HKEY_LOCAL_MACHINE$" AND OSPath.Components[Source.Depth + 1] =~ "^System$",`,
+		`_ReadControlSets(HivePath=OSPath + "Windows/System32/Config/System") AS ControlSets`,
+		`HivePath=Device + "Windows/System32/Config/System",
+      RegistryPath=Prefix + "HKEY_LOCAL_MACHINE\\System",`,
+		`RegistryPath=Prefix + "Settings\\" + UserKey + "\\" + OSPath[-2],`,
+		`FROM glob(globs="*/AppData/Local/Packages/*/Settings.dat", root=Device + "Users/")`,
+	} {
+		assert.Contains(t, artifact, expected)
+	}
+
+	// Strategies must be defined.
+	_, err = config.LoadMounts([]byte(testMounts + `
+- Name: DEFAULT
+  Parameter: PathTODefault
+  Path: Windows/System32/Config/Default
+  Root: HKEY_USERS\.DEFAULT
+  Mounts:
+  - Strategies: [Live]
+`))
+	assert.EqualError(t, err, "Hive DEFAULT: Unknown strategy Live")
+
+	_, err = config.LoadMounts([]byte(strings.Replace(testMounts,
+		"  Strategy: Raw Hives", "  Strategy: Live", 1)))
+	assert.EqualError(t, err, "ShadowCopies: Unknown strategy Live")
+
+	_, err = config.LoadMounts([]byte(strings.Replace(testMounts,
+		"ControlSet: Current", "ControlSet: Default", 1)))
+	assert.EqualError(t, err, "Hive SYSTEM: Unknown control set Default")
+}
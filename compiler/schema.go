@@ -0,0 +1,236 @@
+package compiler
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Velocidex/registry_hunter/config"
+)
+
+const (
+	JSON_SCHEMA_DRAFT = "http://json-schema.org/draft-07/schema#"
+	SCHEMA_TITLE      = "Registry Hunter rules"
+)
+
+// A JSON Schema (draft 07) describing the rule file format. Only the
+// keywords we generate are supported.
+type Schema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+
+	Enum     []string `json:"enum,omitempty"`
+	Examples []string `json:"examples,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+}
+
+// Fields filled in by the compiler are not part of the schema.
+var schemaSkippedFields = map[string]bool{
+	"config.RegistryRule.Source": true,
+}
+
+// The descriptions of the types and fields by their qualified name
+// (e.g. config.RegistryRule.Glob), taken from the Go comments.
+func schemaDescriptions() map[string]string {
+	result := make(map[string]string)
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", config.APISource, parser.ParseComments)
+	if err != nil {
+		return result
+	}
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			type_spec := spec.(*ast.TypeSpec)
+			name := file.Name.Name + "." + type_spec.Name.Name
+
+			doc := type_spec.Doc
+			if doc == nil {
+				doc = gen.Doc
+			}
+			result[name] = commentText(doc)
+
+			struct_type, ok := type_spec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+
+			for _, field := range struct_type.Fields.List {
+				for _, field_name := range field.Names {
+					result[name+"."+field_name.Name] = commentText(field.Doc)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Comments are wrapped so we join them into a single line.
+func commentText(group *ast.CommentGroup) string {
+	if group == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(group.Text()), " ")
+}
+
+type schemaBuilder struct {
+	descriptions map[string]string
+	definitions  map[string]*Schema
+}
+
+func qualifiedName(t reflect.Type) string {
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+// Build the schema of a type. Structs are added to the definitions
+// and referred to, since the hive specs are recursive.
+func (self *schemaBuilder) schemaFor(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return self.schemaFor(t.Elem())
+
+	case reflect.String:
+		return &Schema{Type: "string"}
+
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+
+	case reflect.Int, reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer"}
+
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: self.schemaFor(t.Elem())}
+
+	case reflect.Struct:
+		_, pres := self.definitions[t.Name()]
+		if !pres {
+			self.definitions[t.Name()] = nil
+			self.definitions[t.Name()] = self.objectSchema(t)
+		}
+		return &Schema{Ref: "#/definitions/" + t.Name()}
+	}
+
+	// Anything goes (e.g. interface{})
+	return &Schema{}
+}
+
+func (self *schemaBuilder) objectSchema(t reflect.Type) *Schema {
+	additional := false
+	result := &Schema{
+		Type:                 "object",
+		Description:          self.descriptions[qualifiedName(t)],
+		Properties:           make(map[string]*Schema),
+		AdditionalProperties: &additional,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		qualified := qualifiedName(t) + "." + field.Name
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if !field.IsExported() || name == "-" || schemaSkippedFields[qualified] {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		property := self.schemaFor(field.Type)
+		property.Description = self.descriptions[qualified]
+		result.Properties[name] = property
+	}
+	return result
+}
+
+// The schema of the rule files. Only the structure is described -
+// see Compiler.Schema() for the values the compiler accepts.
+func RuleFileSchema() *Schema {
+	builder := &schemaBuilder{
+		descriptions: schemaDescriptions(),
+		definitions:  make(map[string]*Schema),
+	}
+
+	result := builder.objectSchema(reflect.TypeOf(config.RuleFile{}))
+	result.Schema = JSON_SCHEMA_DRAFT
+	result.Title = SCHEMA_TITLE
+	result.Required = []string{"Rules"}
+	result.Definitions = builder.definitions
+	return result
+}
+
+// The schema of the rule files including the values accepted by this
+// compiler (e.g. the Root of the mounted hives) and the categories of
+// the rules loaded so far. Editors use this for completion and
+// validation.
+func (self *Compiler) Schema() *Schema {
+	result := RuleFileSchema()
+
+	rule := result.Definitions["RegistryRule"]
+	rule.Required = []string{"Id", "Description"}
+
+	rule.Properties["Id"].Pattern = idRegex.String()
+	rule.Properties["Root"].Examples = self.allowedRoots()
+	rule.Properties["Root"].Pattern = rootPattern(self.allowedRoots())
+	rule.Properties["Severity"].Enum = config.RuleSeverities
+	rule.Properties["Kind"].Enum = config.RuleKinds
+	rule.Properties["Status"].Enum = config.RuleStatuses
+	rule.Properties["Techniques"].Items.Pattern = config.TechniqueRegex.String()
+
+	// New categories may be added so these are only suggestions.
+	categories := make(map[string]bool)
+	for _, r := range self.loaded {
+		categories[r.Category] = true
+	}
+
+	for category := range categories {
+		rule.Properties["Category"].Examples = append(
+			rule.Properties["Category"].Examples, category)
+	}
+	sort.Strings(rule.Properties["Category"].Examples)
+
+	return result
+}
+
+// Roots are accepted in any case and with either path separator (see
+// normalizeRoot). JSON Schema patterns have no flags so every letter
+// matches both cases.
+func rootPattern(roots []string) string {
+	alternatives := make([]string, 0, len(roots))
+	for _, root := range roots {
+		alternative := ""
+		for _, c := range root {
+			upper, lower := unicode.ToUpper(c), unicode.ToLower(c)
+			switch {
+			case c == '\\' || c == '/':
+				alternative += `[\\/]+`
+			case upper != lower:
+				alternative += "[" + string(upper) + string(lower) + "]"
+			default:
+				alternative += regexp.QuoteMeta(string(c))
+			}
+		}
+		alternatives = append(alternatives, alternative)
+	}
+	return "^(" + strings.Join(alternatives, "|") + ")$"
+}
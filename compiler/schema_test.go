@@ -0,0 +1,95 @@
+package compiler
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const schemaRules = `
+Rules:
+- Id: run
+  Description: Run keys
+  Category: ASEP
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glb: Microsoft\Windows\CurrentVersion\Run\*
+- Id: run-once
+  description: RunOnce keys
+  Category: ASEP
+  Techniques: T1547.001
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\RunOnce\*
+  Tests:
+  - Hives:
+    - Keys:
+      - Name: Microsoft
+        Valus: []
+- Id: services
+  Description: Services
+  Category: Services
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: CurrentControlSet\Services\*
+`
+
+func TestSchema(t *testing.T) {
+	schema := RuleFileSchema()
+
+	// Descriptions are taken from the comments.
+	rule := schema.Definitions["RegistryRule"]
+	assert.Contains(t, rule.Properties["Globs"].Description,
+		"A rule may search for several globs")
+	assert.Contains(t, schema.Definitions["TestValue"].Properties["Type"].Description,
+		"REG_* type names")
+
+	// The compiler filled fields are not part of the schema.
+	assert.NotContains(t, rule.Properties, "Source")
+
+	// The hive specs are recursive.
+	key_spec := schema.Definitions["TestKey"]
+	assert.Equal(t, "#/definitions/TestKey", key_spec.Properties["Keys"].Items.Ref)
+
+	violations := []string{}
+	for _, v := range schema.Validate([]byte(schemaRules)) {
+		violations = append(violations, v.Path+": "+v.Message)
+	}
+	assert.Equal(t, []string{
+		"Rules[0]: unknown field Glb (did you mean Glob?)",
+		"Rules[1]: unknown field description (did you mean Description?)",
+		"Rules[1].Techniques: expected a list",
+		"Rules[1].Tests[0].Hives[0].Keys[0]: unknown field Valus (did you mean Values?)",
+	}, violations)
+
+	// Only the rules with problems are skipped.
+	rules_compiler := NewCompiler()
+	diagnostics, err := rules_compiler.LoadRules(writeTestRules(t, schemaRules))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, diagnostics.Count(SEVERITY_ERROR))
+	assert.Equal(t, 7, diagnostics[0].Line)
+	assert.Equal(t, 3, diagnostics[0].Column)
+
+	ids := []string{}
+	for _, r := range rules_compiler.Rules() {
+		ids = append(ids, r.Id)
+	}
+	assert.Equal(t, []string{"services"}, ids)
+
+	// The compiler adds the values it accepts.
+	schema = rules_compiler.Schema()
+	rule = schema.Definitions["RegistryRule"]
+	assert.Contains(t, rule.Properties["Root"].Examples, "HKEY_USERS")
+
+	// Roots are matched like the compiler does, in any case and with
+	// either separator.
+	root := regexp.MustCompile(rule.Properties["Root"].Pattern)
+	for _, r := range []string{"", "HKEY_USERS",
+		`HKEY_LOCAL_MACHINE\Software`, "HKEY_LOCAL_MACHINE/SOFTWARE",
+		"hkey_local_machine//system"} {
+		assert.True(t, root.MatchString(r), r)
+	}
+	assert.False(t, root.MatchString("HKEY_CURRENT_USER"))
+	assert.False(t, root.MatchString("HKEY_LOCAL_MACHINE"))
+	assert.Equal(t, []string{"Services"}, rule.Properties["Category"].Examples)
+	assert.Equal(t, []string{"info", "low", "medium", "high"},
+		rule.Properties["Severity"].Enum)
+}
@@ -0,0 +1,205 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	yaml_v3 "gopkg.in/yaml.v3"
+)
+
+// A problem with the structure of a rule file.
+type SchemaViolation struct {
+	// Where the problem is (e.g. Rules[3].Glob)
+	Path string
+
+	// The rule the problem is in or -1 if it is outside the rules.
+	Rule int
+
+	Line    int
+	Column  int
+	Message string
+}
+
+// Check the structure of the rule file against the schema: the types
+// of the fields and unknown fields (usually typos). The values (e.g.
+// enum and pattern) are checked by the compiler itself, which reports
+// them with more specific diagnostics. A file which is not valid YAML
+// has no violations since the YAML parser reports a better error.
+//
+// Like findPositions, this uses the yaml.v3 node tree because
+// Velocidex/yaml/v2 does not report the positions of the problems.
+func (self *Schema) Validate(data []byte) []SchemaViolation {
+	root := &yaml_v3.Node{}
+	err := yaml_v3.Unmarshal(data, root)
+	if err != nil || len(root.Content) == 0 {
+		return nil
+	}
+
+	validator := &schemaValidator{root: self}
+	validator.validate(self, root.Content[0], "", -1)
+	return validator.violations
+}
+
+type schemaValidator struct {
+	root       *Schema
+	violations []SchemaViolation
+}
+
+func (self *schemaValidator) report(
+	node *yaml_v3.Node, path string, rule int,
+	format string, args ...interface{}) {
+	self.violations = append(self.violations, SchemaViolation{
+		Path:    path,
+		Rule:    rule,
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (self *schemaValidator) resolve(schema *Schema) *Schema {
+	for schema.Ref != "" {
+		definition, pres := self.root.Definitions[strings.TrimPrefix(
+			schema.Ref, "#/definitions/")]
+		if !pres {
+			return &Schema{}
+		}
+		schema = definition
+	}
+	return schema
+}
+
+func (self *schemaValidator) validate(
+	schema *Schema, node *yaml_v3.Node, path string, rule int) {
+	schema = self.resolve(schema)
+
+	if node.Kind == yaml_v3.AliasNode {
+		node = node.Alias
+	}
+
+	// A null is the zero value of any type.
+	if node.Kind == yaml_v3.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	switch schema.Type {
+	case "object":
+		if node.Kind != yaml_v3.MappingNode {
+			self.report(node, path, rule, "expected a mapping")
+			return
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			property, pres := schema.Properties[key]
+			if !pres {
+				if schema.AdditionalProperties != nil &&
+					!*schema.AdditionalProperties {
+					self.report(node.Content[i], path, rule,
+						"unknown field %v%v", key, didYouMean(key, schema))
+				}
+				continue
+			}
+
+			self.validate(property, node.Content[i+1],
+				joinSchemaPath(path, key), rule)
+		}
+
+	case "array":
+		if node.Kind != yaml_v3.SequenceNode {
+			self.report(node, path, rule, "expected a list")
+			return
+		}
+
+		for i, item := range node.Content {
+			item_rule := rule
+			if path == "Rules" {
+				item_rule = i
+			}
+			self.validate(schema.Items, item,
+				fmt.Sprintf("%v[%v]", path, i), item_rule)
+		}
+
+	// Like the YAML decoder we accept any scalar for a string.
+	case "string":
+		if node.Kind != yaml_v3.ScalarNode {
+			self.report(node, path, rule, "expected a string")
+		}
+
+	case "boolean":
+		if node.Kind != yaml_v3.ScalarNode || node.Tag != "!!bool" {
+			self.report(node, path, rule, "expected true or false")
+		}
+
+	case "integer":
+		if node.Kind != yaml_v3.ScalarNode || node.Tag != "!!int" {
+			self.report(node, path, rule, "expected an integer")
+		}
+	}
+}
+
+func joinSchemaPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Suggest the closest known field for a typo.
+func didYouMean(key string, schema *Schema) string {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best := ""
+	best_distance := 3
+	for _, name := range names {
+		if strings.EqualFold(name, key) {
+			return fmt.Sprintf(" (did you mean %v?)", name)
+		}
+
+		distance := editDistance(strings.ToLower(name), strings.ToLower(key))
+		if distance < best_distance {
+			best = name
+			best_distance = distance
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %v?)", best)
+}
+
+// The Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1,
+				minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
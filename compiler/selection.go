@@ -0,0 +1,150 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Velocidex/registry_hunter/config"
+)
+
+const (
+	DEFAULT_ARTIFACT_NAME = "Windows.Registry.Hunter"
+
+	CODE_UNKNOWN_SELECTION    = "unknown-selection"
+	CODE_DEPRECATED_SELECTION = "deprecated-selection"
+)
+
+// Select a subset of the loaded rules to build into the artifact. A
+// rule must match every non-empty list and may match any entry
+// within a list. Categories, tags and roots are compared case
+// insensitively.
+type RuleSelection struct {
+	Categories        []string
+	ExcludeCategories []string
+	RuleIds           []string
+	Tags              []string
+
+	// A rule matches a root if its Root is the same key or a subkey.
+	Roots []string
+}
+
+func (self RuleSelection) IsEmpty() bool {
+	return len(self.Categories) == 0 && len(self.ExcludeCategories) == 0 &&
+		len(self.RuleIds) == 0 && len(self.Tags) == 0 && len(self.Roots) == 0
+}
+
+func containsFold(list []string, item string) bool {
+	for _, i := range list {
+		if strings.EqualFold(i, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesRoot(roots []string, root string) bool {
+	for _, r := range roots {
+		r = strings.TrimSuffix(pathSepRegex.ReplaceAllString(r, "\\"), "\\")
+		if strings.EqualFold(r, root) ||
+			strings.HasPrefix(strings.ToLower(root), strings.ToLower(r)+"\\") {
+			return true
+		}
+	}
+	return false
+}
+
+func (self RuleSelection) Matches(r *config.RegistryRule) bool {
+	if len(self.Categories) > 0 && !containsFold(self.Categories, r.Category) {
+		return false
+	}
+
+	if containsFold(self.ExcludeCategories, r.Category) {
+		return false
+	}
+
+	if len(self.RuleIds) > 0 {
+		found := false
+		for _, id := range self.RuleIds {
+			if id == r.Id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(self.Tags) > 0 {
+		found := false
+		for _, tag := range r.Tags {
+			if containsFold(self.Tags, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(self.Roots) > 0 && !matchesRoot(self.Roots, r.Root) {
+		return false
+	}
+
+	return true
+}
+
+// Warn about selections that do not match any loaded rule - these
+// are usually typos.
+func (self *Compiler) checkSelection() {
+	categories := make(map[string]bool)
+	tags := make(map[string]bool)
+	for _, r := range self.loaded {
+		categories[strings.ToLower(r.Category)] = true
+		for _, tag := range r.Tags {
+			tags[strings.ToLower(tag)] = true
+		}
+	}
+
+	check := func(kind string, selected []string, known func(string) bool) {
+		for _, item := range selected {
+			if !known(item) {
+				self.resolve_diagnostics = append(self.resolve_diagnostics,
+					newDiagnostic(SEVERITY_WARNING, CODE_UNKNOWN_SELECTION, "", nil,
+						"No rule has the selected %v %v", kind, item))
+			}
+		}
+	}
+
+	has_category := func(item string) bool {
+		return categories[strings.ToLower(item)]
+	}
+	check("category", self.Selection.Categories, has_category)
+	check("category", self.Selection.ExcludeCategories, has_category)
+	check("rule Id", self.Selection.RuleIds, func(item string) bool {
+		_, pres := self.ids[item]
+		return pres
+	})
+	check("tag", self.Selection.Tags, func(item string) bool {
+		return tags[strings.ToLower(item)]
+	})
+
+	for _, id := range self.Selection.RuleIds {
+		r, pres := self.ids[id]
+		if pres && r.Status == config.RULE_STATUS_DEPRECATED {
+			self.resolve_diagnostics = append(self.resolve_diagnostics,
+				newDiagnostic(SEVERITY_WARNING, CODE_DEPRECATED_SELECTION, "", &r,
+					"%v", DeprecationMessage(&r)))
+		}
+	}
+}
+
+// Explain that the rule is deprecated and what replaces it.
+func DeprecationMessage(r *config.RegistryRule) string {
+	if r.ReplacedBy == "" {
+		return fmt.Sprintf("Rule %v (%v) is deprecated", r.Description, r.Id)
+	}
+	return fmt.Sprintf("Rule %v (%v) is deprecated, use rule %v instead",
+		r.Description, r.Id, r.ReplacedBy)
+}
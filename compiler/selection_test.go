@@ -0,0 +1,109 @@
+package compiler
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const selectionRules = `
+Preamble:
+- |
+  LET ParseRun(x) = x.Data
+- |
+  LET ParseService(x) = x.Data
+Rules:
+- Id: run
+  Description: Run keys
+  Category: ASEP
+  Tags: [triage]
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\Run\*
+  Details: x=>ParseRun(x=x)
+- Id: services
+  Description: Services
+  Category: ASEP
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: ControlSet001\Services\*
+  Details: x=>ParseService(x=x)
+- Id: userassist
+  Description: UserAssist
+  Category: Program Execution
+  Tags: [Triage, user]
+  Root: HKEY_USERS
+  Glob: '*\Software\Microsoft\Windows\CurrentVersion\Explorer\UserAssist\*'
+- Id: new-services
+  Description: Services (updated)
+  Category: Persistence
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: ControlSet001\Services\*
+  Overrides: [services]
+`
+
+func selectedIds(t *testing.T, selection RuleSelection) []string {
+	rules_compiler := NewCompiler()
+	rules_compiler.Selection = selection
+	loadTestRules(t, rules_compiler, selectionRules)
+
+	result := []string{}
+	for _, r := range rules_compiler.Rules() {
+		result = append(result, r.Id)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestSelection(t *testing.T) {
+	assert.Equal(t, []string{"new-services", "run", "userassist"},
+		selectedIds(t, RuleSelection{}))
+
+	// The overriding rule is not selected so does not replace the
+	// services rule.
+	assert.Equal(t, []string{"run", "services"},
+		selectedIds(t, RuleSelection{Categories: []string{"asep"}}))
+
+	assert.Equal(t, []string{"new-services", "userassist"},
+		selectedIds(t, RuleSelection{ExcludeCategories: []string{"ASEP"}}))
+
+	assert.Equal(t, []string{"run", "userassist"},
+		selectedIds(t, RuleSelection{Tags: []string{"triage"}}))
+
+	assert.Equal(t, []string{"run"},
+		selectedIds(t, RuleSelection{
+			Tags:  []string{"triage"},
+			Roots: []string{"HKEY_LOCAL_MACHINE/"},
+		}))
+
+	assert.Equal(t, []string{"new-services", "run"},
+		selectedIds(t, RuleSelection{Roots: []string{"hkey_local_machine"}}))
+
+	assert.Equal(t, []string{"userassist"},
+		selectedIds(t, RuleSelection{RuleIds: []string{"userassist", "missing"}}))
+
+	// Categories and preamble only include what the selected rules
+	// need.
+	rules_compiler := NewCompiler()
+	rules_compiler.Name = "Custom.Triage"
+	rules_compiler.Selection = RuleSelection{
+		Categories: []string{"ASEP"},
+		RuleIds:    []string{"run", "missing"},
+	}
+	loadTestRules(t, rules_compiler, selectionRules)
+
+	artifact, diagnostics, err := rules_compiler.Compile()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(artifact, "name: Custom.Triage\n"))
+	assert.Equal(t, []string{"ASEP"}, rules_compiler.buildCategories())
+	assert.Contains(t, artifact, "LET ParseRun(x)")
+	assert.NotContains(t, artifact, "LET ParseService(x)")
+
+	messages := []string{}
+	for _, d := range diagnostics {
+		if d.Code == CODE_UNKNOWN_SELECTION {
+			messages = append(messages, d.Message)
+		}
+	}
+	assert.Equal(t, []string{"No rule has the selected rule Id missing"}, messages)
+}
@@ -0,0 +1,56 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const severityRules = `
+Rules:
+- Id: run
+  Description: Run keys
+  Category: ASEP
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\Run\*
+- Id: rclone
+  Description: Rclone
+  Category: Threat Hunting
+  Severity: High
+  Kind: Detection
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Rclone\*
+- Id: bad
+  Description: Bad severity
+  Category: ASEP
+  Severity: critical
+  Kind: alert
+  Root: HKEY_LOCAL_MACHINE\Software
+  Glob: Microsoft\Windows\CurrentVersion\RunServices\*
+`
+
+func TestSeverity(t *testing.T) {
+	rules_compiler := NewCompiler()
+	loadTestRules(t, rules_compiler, severityRules)
+
+	codes := []string{}
+	for _, d := range rules_compiler.Diagnostics() {
+		codes = append(codes, d.Severity+" "+d.Code)
+	}
+	assert.Equal(t, []string{
+		"error invalid-severity",
+		"error invalid-kind",
+	}, codes)
+
+	// Severities and kinds are normalized and default to info and
+	// inventory.
+	severities := make(map[string]string)
+	for _, r := range rules_compiler.Rules() {
+		severities[r.Id] = r.Severity + " " + r.Kind
+	}
+	assert.Equal(t, map[string]string{
+		"run":    "info inventory",
+		"rclone": "high detection",
+		"bad":    "critical alert",
+	}, severities)
+}
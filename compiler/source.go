@@ -0,0 +1,127 @@
+package compiler
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/Velocidex/registry_hunter/config"
+	yaml_v3 "gopkg.in/yaml.v3"
+)
+
+var (
+	yamlLineRegex = regexp.MustCompile(`line (\d+)`)
+)
+
+// A preamble verse along with where it was defined.
+type PreambleVerse struct {
+	Verse  string
+	Source *config.SourceLocation
+}
+
+// The positions of the rules and preamble verses in a rule file.
+type filePositions struct {
+	filename string
+
+	// The global preamble
+	preamble []*config.SourceLocation
+
+	rules          []*config.SourceLocation
+	rule_preambles [][]*config.SourceLocation
+}
+
+func (self *filePositions) rule(i int) *config.SourceLocation {
+	if i < len(self.rules) {
+		return self.rules[i]
+	}
+	return &config.SourceLocation{File: self.filename}
+}
+
+func (self *filePositions) rulePreamble(rule, i int) *config.SourceLocation {
+	if rule < len(self.rule_preambles) && i < len(self.rule_preambles[rule]) {
+		return self.rule_preambles[rule][i]
+	}
+	return self.rule(rule)
+}
+
+func (self *filePositions) globalPreamble(i int) *config.SourceLocation {
+	if i < len(self.preamble) {
+		return self.preamble[i]
+	}
+	return &config.SourceLocation{File: self.filename}
+}
+
+// The YAML library we use to parse the rules does not report
+// positions so we parse the file again into a node tree just to find
+// where each rule starts. If this fails we just do not have any line
+// numbers.
+func findPositions(filename string, data []byte) *filePositions {
+	result := &filePositions{filename: filename}
+
+	root := &yaml_v3.Node{}
+	err := yaml_v3.Unmarshal(data, root)
+	if err != nil {
+		return result
+	}
+
+	if root.Kind == yaml_v3.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	result.preamble = sequencePositions(filename, mappingValue(root, "Preamble"))
+
+	rules := mappingValue(root, "Rules")
+	if rules == nil || rules.Kind != yaml_v3.SequenceNode {
+		return result
+	}
+
+	for _, item := range rules.Content {
+		result.rules = append(result.rules, nodePosition(filename, item))
+		result.rule_preambles = append(result.rule_preambles,
+			sequencePositions(filename, mappingValue(item, "Preamble")))
+	}
+
+	return result
+}
+
+func mappingValue(node *yaml_v3.Node, key string) *yaml_v3.Node {
+	if node == nil || node.Kind != yaml_v3.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func sequencePositions(filename string,
+	node *yaml_v3.Node) (result []*config.SourceLocation) {
+	if node == nil || node.Kind != yaml_v3.SequenceNode {
+		return nil
+	}
+
+	for _, item := range node.Content {
+		result = append(result, nodePosition(filename, item))
+	}
+	return result
+}
+
+func nodePosition(filename string, node *yaml_v3.Node) *config.SourceLocation {
+	return &config.SourceLocation{
+		File:   filename,
+		Line:   node.Line,
+		Column: node.Column,
+	}
+}
+
+// YAML errors mention the line but not in a structured way.
+func errorLine(err error) int {
+	m := yamlLineRegex.FindStringSubmatch(err.Error())
+	if len(m) < 2 {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
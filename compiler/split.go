@@ -0,0 +1,161 @@
+package compiler
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+
+	"github.com/Velocidex/registry_hunter/config"
+)
+
+//go:embed split_common_template.yaml
+var split_common_template string
+
+//go:embed split_category_template.yaml
+var split_category_template string
+
+//go:embed split_umbrella_template.yaml
+var split_umbrella_template string
+
+var (
+	artifactNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// An artifact built by the compiler.
+type Artifact struct {
+	Name       string
+	Definition string
+}
+
+// The artifact running the rules of a single category.
+type CategoryArtifact struct {
+	Category string
+	Name     string
+}
+
+// The name of the artifact holding the definitions shared by the
+// split artifacts.
+func (self *Compiler) CommonArtifactName() string {
+	return self.Name + ".Common"
+}
+
+// Categories may contain spaces which are not allowed in artifact
+// names.
+func (self *Compiler) CategoryArtifactName(category string) string {
+	return self.Name + "." + artifactNameRegex.ReplaceAllString(category, "")
+}
+
+func (self *Compiler) categoryArtifacts() ([]CategoryArtifact, error) {
+	result := []CategoryArtifact{}
+	names := make(map[string]string)
+	for _, category := range self.buildCategories() {
+		name := self.CategoryArtifactName(category)
+		existing, pres := names[name]
+		if pres {
+			return nil, fmt.Errorf(
+				"Categories %v and %v both map to artifact %v",
+				existing, category, name)
+		}
+		names[name] = category
+		result = append(result, CategoryArtifact{
+			Category: category,
+			Name:     name,
+		})
+	}
+	return result, nil
+}
+
+func rulesInCategory(rules []config.RegistryRule,
+	category string) (result []config.RegistryRule) {
+	for _, r := range rules {
+		if r.Category == category {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// Compile one artifact for each category along with an artifact
+// holding the shared definitions (remapping and preamble) and an
+// umbrella artifact collecting the categories. The umbrella artifact
+// is last.
+func (self *Compiler) CompileSplit() ([]Artifact, Diagnostics, error) {
+	diagnostics := self.Diagnostics()
+	err := diagnostics.Err()
+	if err != nil {
+		return nil, diagnostics, err
+	}
+
+	err = self.ValidateTemplates()
+	if err != nil {
+		return nil, diagnostics, err
+	}
+
+	category_artifacts, err := self.categoryArtifacts()
+	if err != nil {
+		return nil, diagnostics, err
+	}
+
+	now := self.buildTime()
+	common := self.CommonArtifactName()
+	result := []Artifact{}
+
+	artifact, err := calculateTemplate(split_common_template, &templateParameters{
+		Name:      common,
+		Artifact:  self.Name,
+		Preamble:  self.buildPreamble(),
+		Time:      now,
+		Remapping: self.remapping(),
+		Data:      self.TemplateData,
+	})
+	if err != nil {
+		return nil, diagnostics, err
+	}
+	result = append(result, Artifact{Name: common, Definition: artifact})
+
+	for _, category_artifact := range category_artifacts {
+		categories := []string{category_artifact.Category}
+		rules := rulesInCategory(self.rules, category_artifact.Category)
+		queries := rulesInCategory(self.queries, category_artifact.Category)
+
+		artifact, err := calculateTemplate(split_category_template, &templateParameters{
+			Name:           category_artifact.Name,
+			Artifact:       self.Name,
+			Common:         common,
+			Category:       category_artifact.Category,
+			Metadata:       self.buildMetadata(rules),
+			Rules:          rules,
+			Categories:     categories,
+			CategoriesJSON: self.serialize(categories),
+			QueriesJSON:    self.compress(self.serialize(withoutSource(queries))),
+			Time:           now,
+			Remapping:      self.remapping(),
+			Data:           self.TemplateData,
+		})
+		if err != nil {
+			return nil, diagnostics, err
+		}
+		result = append(result, Artifact{
+			Name:       category_artifact.Name,
+			Definition: artifact,
+		})
+	}
+
+	categories := self.buildCategories()
+	artifact, err = calculateTemplate(split_umbrella_template, &templateParameters{
+		Name:              self.Name,
+		Common:            common,
+		Categories:        categories,
+		CategoriesJSON:    self.serialize(categories),
+		CategoryArtifacts: category_artifacts,
+		Time:              now,
+		Remapping:         self.remapping(),
+		Data:              self.TemplateData,
+	})
+	if err != nil {
+		return nil, diagnostics, err
+	}
+	result = append(result, Artifact{Name: self.Name, Definition: artifact})
+
+	return result, diagnostics, nil
+}
@@ -0,0 +1,94 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/Velocidex/yaml/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type testArtifact struct {
+	Name    string   `json:"name"`
+	Imports []string `json:"imports"`
+	Export  string   `json:"export"`
+	Sources []struct {
+		Name  string `json:"name"`
+		Query string `json:"query"`
+	} `json:"sources"`
+}
+
+func TestSplit(t *testing.T) {
+	rules_compiler := NewCompiler()
+	rules_compiler.Split = true
+	loadTestRules(t, rules_compiler, selectionRules)
+
+	artifacts, _, err := rules_compiler.CompileArtifacts()
+	assert.NoError(t, err)
+
+	parsed := make(map[string]*testArtifact)
+	names := []string{}
+	for _, a := range artifacts {
+		item := &testArtifact{}
+		assert.NoError(t, yaml.Unmarshal([]byte(a.Definition), item))
+		assert.Equal(t, a.Name, item.Name)
+		parsed[a.Name] = item
+		names = append(names, a.Name)
+	}
+
+	assert.Equal(t, []string{
+		"Windows.Registry.Hunter.Common",
+		"Windows.Registry.Hunter.ASEP",
+		"Windows.Registry.Hunter.Persistence",
+		"Windows.Registry.Hunter.ProgramExecution",
+		"Windows.Registry.Hunter",
+	}, names)
+
+	// The preamble is only in the common artifact.
+	common := parsed["Windows.Registry.Hunter.Common"]
+	assert.Contains(t, common.Export, "LET ParseRun(x)")
+	assert.Contains(t, common.Export, "LET RemapRules")
+
+	asep := parsed["Windows.Registry.Hunter.ASEP"]
+	assert.Equal(t, []string{"Windows.Registry.Hunter.Common"}, asep.Imports)
+	assert.Contains(t, asep.Export, "LET _MD")
+	assert.NotContains(t, asep.Export, "LET ParseRun(x)")
+	assert.Equal(t, 1, len(asep.Sources))
+	assert.Equal(t, "Results", asep.Sources[0].Name)
+
+	// The umbrella artifact calls each category artifact.
+	umbrella := parsed["Windows.Registry.Hunter"]
+	assert.Equal(t, []string{"Windows.Registry.Hunter.Common"}, umbrella.Imports)
+	assert.Equal(t, "Results", umbrella.Sources[2].Name)
+	for _, name := range names[1:4] {
+		assert.Contains(t, umbrella.Sources[2].Query, "Artifact."+name+"(")
+	}
+
+	// Only the rules of the category are in its metadata
+	rules := rulesInCategory(rules_compiler.Rules(), "Program Execution")
+	assert.Equal(t, 1, len(rules))
+	assert.Equal(t, "userassist", rules[0].Id)
+
+	// The meta artifact needs the preamble from the common artifact.
+	meta, err := rules_compiler.CompileMeta()
+	assert.NoError(t, err)
+	assert.Contains(t, meta, "- Windows.Registry.Hunter.Common\n")
+
+	// Categories must map to distinct artifact names.
+	rules_compiler = NewCompiler()
+	rules_compiler.Split = true
+	loadTestRules(t, rules_compiler, `
+Rules:
+- Id: first
+  Description: First
+  Category: Program Execution
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: Select\*
+- Id: second
+  Description: Second
+  Category: ProgramExecution
+  Root: HKEY_LOCAL_MACHINE\System
+  Glob: Setup\*
+`)
+	_, _, err = rules_compiler.CompileArtifacts()
+	assert.EqualError(t, err, "Categories Program Execution and ProgramExecution both map to artifact Windows.Registry.Hunter.ProgramExecution")
+}
@@ -9,11 +9,15 @@ import (
 	"os"
 	"strings"
 	"text/template"
+	"text/template/parse"
 
 	"github.com/Masterminds/sprig"
 )
 
-func calculateTemplate(template_str string, params interface{}) (string, error) {
+// Parse the template along with the shared sections. Templates have
+// access to the sprig functions as well as Indent, ReadFile and
+// Compress.
+func parseTemplate(template_str string) (*template.Template, error) {
 	var templ *template.Template
 	var err error
 
@@ -50,6 +54,17 @@ func calculateTemplate(template_str string, params interface{}) (string, error)
 	templ, err = template.New("").
 		Funcs(sprig.TxtFuncMap()).
 		Funcs(funcMap).Parse(template_str)
+	if err != nil {
+		return nil, err
+	}
+
+	// The shared sections only contain definitions so do not replace
+	// the main template.
+	return templ.Parse(artifact_sections)
+}
+
+func calculateTemplate(template_str string, params interface{}) (string, error) {
+	templ, err := parseTemplate(template_str)
 	if err != nil {
 		return "", err
 	}
@@ -63,6 +78,85 @@ func calculateTemplate(template_str string, params interface{}) (string, error)
 	return string(b.Bytes()), nil
 }
 
+// Check that the template uses all the required fields of the
+// template parameters, either directly or through the sections it
+// includes.
+func validateTemplate(template_str string, required ...string) error {
+	templ, err := parseTemplate(template_str)
+	if err != nil {
+		return err
+	}
+
+	fields := make(map[string]bool)
+	visited := make(map[string]bool)
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, child := range n.Nodes {
+					walk(child)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, cmd := range n.Cmds {
+					walk(cmd)
+				}
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.FieldNode:
+			fields[n.Ident[0]] = true
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 {
+				fields[n.Ident[1]] = true
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+			if !visited[n.Name] {
+				visited[n.Name] = true
+				included := templ.Lookup(n.Name)
+				if included != nil && included.Tree != nil {
+					walk(included.Tree.Root)
+				}
+			}
+		}
+	}
+	walk(templ.Tree.Root)
+
+	missing := []string{}
+	for _, field := range required {
+		if !fields[field] {
+			missing = append(missing, "."+field)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("Template does not use the required fields %v",
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 func indentTemplate(args ...interface{}) interface{} {
 	if len(args) != 2 {
 		return ""
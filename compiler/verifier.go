@@ -5,12 +5,16 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/Velocidex/registry_hunter/config"
 	"github.com/Velocidex/registry_hunter/converters"
 	"github.com/Velocidex/yaml/v2"
 )
 
+// Maps the description of a RECmd rule to the Id of the rule
+// implementing it.
 type Mapping struct {
 	RECmdRules map[string]string `json:"RECmdRules"`
 }
@@ -66,19 +70,40 @@ func VerifyRECmd(
 
 	rules_compiler := NewCompiler()
 	for _, filename := range rules {
-		err = rules_compiler.LoadRules(filename)
+		_, err = rules_compiler.LoadRules(filename)
 		if err != nil {
 			return err
 		}
 	}
 
+	// Mappings should point at the rules replacing deprecated rules.
+	descriptions := make([]string, 0, len(mapping.RECmdRules))
+	for description := range mapping.RECmdRules {
+		descriptions = append(descriptions, description)
+	}
+	sort.Strings(descriptions)
+
+	for _, description := range descriptions {
+		target := mapping.RECmdRules[description]
+		rule, pres := rules_compiler.md[target]
+
+		if pres && rule.Status == config.RULE_STATUS_DEPRECATED {
+			fmt.Printf("Warning: RECmd rule %v is mapped to a deprecated rule: %v\n",
+				description, DeprecationMessage(&rule))
+		}
+	}
+
 	counter := 0
 
 	// Iterate over all the the REB rules
 	for _, rule := range rules_converter.GetRules() {
-		// If the description is the same as an existing rule, this is
-		// fine.
-		_, pres := rules_compiler.md[rule.Description]
+		// Rules disabled in the batch file need not be implemented.
+		if rule.Disabled {
+			continue
+		}
+
+		// If the rule was already converted it has the same Id.
+		_, pres := rules_compiler.ids[rule.Id]
 		if pres {
 			continue
 		}
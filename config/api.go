@@ -1,26 +1,95 @@
 package config
 
+import (
+	"fmt"
+)
+
 type RuleFile struct {
-	Comment  string         `json:"Comment,omitempty"`
-	Preamble []string       `json:"Preamble,omitempty"`
-	Rules    []RegistryRule `json:"Rules"`
+	// Describes the rules in the file.
+	Comment string `json:"Comment,omitempty"`
+
+	// VQL added to the artifact preamble, available to all the rules.
+	Preamble []string `json:"Preamble,omitempty"`
+
+	Rules []RegistryRule `json:"Rules"`
 }
 
 type RegistryRule struct {
+	// A unique and stable ID for the rule (a UUID or a slug). Unlike
+	// the Description, this should never change so it can be used to
+	// refer to the rule (e.g. in the RuleFilter parameter).
+	Id string `json:"Id,omitempty"`
+
+	// What the rule finds, shown in the Description column.
 	Description string `json:"Description,omitempty"`
-	Category    string `json:"Category,omitempty"`
-	Author      string `json:"Author,omitempty,omitempty"`
-	Reference   string `json:"Reference,omitempty"`
-	Comment     string `json:"Comment,omitempty"`
+
+	// Rules are grouped by category in the artifact (e.g. ASEP).
+	Category string `json:"Category,omitempty"`
+
+	// The name of the author of the rule.
+	Author string `json:"Author,omitempty,omitempty"`
+
+	// A link describing the artifact the rule finds.
+	Reference string `json:"Reference,omitempty"`
+
+	// More details about the rule, shown in the artifact output.
+	Comment string `json:"Comment,omitempty"`
+
+	// The MITRE ATT&CK techniques or sub-techniques the rule detects
+	// (e.g. T1547.001).
+	Techniques []string `json:"Techniques,omitempty"`
+
+	// How important a hit is (info, low, medium or high). The
+	// compiler defaults this to info.
+	Severity string `json:"Severity,omitempty"`
+
+	// Whether the rule is an inventory or a detection rule. Every hit
+	// of a detection rule raises an alert. The compiler defaults this
+	// to inventory.
+	Kind string `json:"Kind,omitempty"`
+
+	// The lifecycle of the rule (experimental, stable or
+	// deprecated). Experimental rules are only applied when the
+	// IncludeExperimental parameter is set. The compiler defaults this
+	// to stable, or deprecated when the rule has a ReplacedBy.
+	Status string `json:"Status,omitempty"`
+
+	// The version of the rule (e.g. the Version of the RECmd batch
+	// file the rule was converted from).
+	Version string `json:"Version,omitempty"`
+
+	// Disabled rules are not compiled into the artifact.
+	Disabled bool `json:"Disabled,omitempty"`
+
+	// Why the rule was disabled.
+	DisabledReason string `json:"DisabledReason,omitempty"`
+
+	// The Id of the rule replacing this deprecated rule.
+	ReplacedBy string `json:"ReplacedBy,omitempty"`
+
+	// Free form labels (e.g. "triage") used to select a subset of
+	// rules at compile time.
+	Tags []string `json:"Tags,omitempty"`
+
+	// The Ids of rules this rule intentionally replaces. The replaced
+	// rules are dropped and do not conflict with this rule.
+	Overrides []string `json:"Overrides,omitempty"`
 
 	// The query will be running in a remapped environment where
 	// certain raw registry hives are mapped into certain paths. For
 	// example the SAM file will be mapped into /SAM. Therfore here we
 	// only need to present a glob and a root and always use the
 	// "registry" accessor.
-	Glob string `json:"Glob"`
+	Glob string `json:"Glob,omitempty"`
+
+	// The key the globs are searched under. This must be the root of
+	// one of the mounted hives (see config/mounts.yaml).
 	Root string `json:"Root"`
 
+	// A rule may search for several globs under the same Root. The
+	// compiler merges Glob into this list and expands braces.
+	Globs []string `json:"Globs,omitempty"`
+
 	// A possible VQL Query to enrich the data. This receives the row
 	// from glob() so has access to anything from the registry key
 	// above.
@@ -40,4 +109,101 @@ type RegistryRule struct {
 	// query. This is useful to add rules that go beyond just simple
 	// glob() (e.g. WMI etc).
 	Query string `json:"Query,omitempty"`
+
+	// Test cases proving the rule matches what it should. These are
+	// run by `reghunter test` over synthetic hives.
+	Tests []RuleTest `json:"Tests,omitempty"`
+
+	// Where the rule was defined. This is filled in by the compiler.
+	Source *SourceLocation `json:"Source,omitempty"`
+}
+
+// A location within a rule file.
+type SourceLocation struct {
+	File   string `json:"File"`
+	Line   int    `json:"Line,omitempty"`
+	Column int    `json:"Column,omitempty"`
+}
+
+func (self *SourceLocation) String() string {
+	if self.Line == 0 {
+		return self.File
+	}
+	return fmt.Sprintf("%v:%v:%v", self.File, self.Line, self.Column)
+}
+
+// All the globs of the rule, whether specified in Glob or Globs.
+func (self *RegistryRule) AllGlobs() []string {
+	if self.Glob == "" {
+		return self.Globs
+	}
+	return append([]string{self.Glob}, self.Globs...)
+}
+
+// A RuleTest mounts some hives and checks that the rule's glob
+// produces exactly the expected rows.
+type RuleTest struct {
+	Name     string        `json:"Name,omitempty"`
+	Hives    []TestHive    `json:"Hives"`
+	Expected []ExpectedRow `json:"Expected"`
+}
+
+type TestHive struct {
+	// Where to mount the hive in the registry. Defaults to the rule's
+	// Root.
+	Mount string `json:"Mount,omitempty"`
+
+	// Path to a hive file or a YAML hive description (ending with
+	// .yaml), relative to the rule file.
+	Path string `json:"Path,omitempty"`
+
+	// Alternatively the hive contents may be given inline.
+	Keys   []TestKey   `json:"Keys,omitempty"`
+	Values []TestValue `json:"Values,omitempty"`
+}
+
+// An inline hive key. These mirror the hive descriptions accepted by
+// `reghunter hive`.
+type TestKey struct {
+	Name string `json:"Name"`
+
+	// RFC3339 timestamp, defaults to the hive's LastWritten.
+	LastWriteTime string `json:"LastWriteTime,omitempty"`
+	ClassName     string `json:"ClassName,omitempty"`
+
+	Values []TestValue `json:"Values,omitempty"`
+	Keys   []TestKey   `json:"Keys,omitempty"`
+
+	// The key is written to unallocated cells, like a deleted key.
+	Deleted bool `json:"Deleted,omitempty"`
+}
+
+type TestValue struct {
+	// The default value has an empty name (or @).
+	Name string `json:"Name"`
+
+	// One of the REG_* type names (default REG_SZ).
+	Type string `json:"Type,omitempty"`
+
+	// The data is interpreted according to the type: A string for
+	// REG_SZ, REG_EXPAND_SZ and REG_LINK, a list of strings for
+	// REG_MULTI_SZ, and an integer for REG_DWORD and REG_QWORD. Other
+	// types require the raw data in Hex.
+	Data interface{} `json:"Data,omitempty"`
+
+	// Hex encoded raw data - overrides Data for any type.
+	Hex string `json:"Hex,omitempty"`
+
+	// The value is only referenced from a previous value list of the
+	// key, like a deleted value.
+	Deleted bool `json:"Deleted,omitempty"`
+}
+
+type ExpectedRow struct {
+	OSPath string `json:"OSPath"`
+
+	// If specified, the value type (e.g. REG_SZ or Key) and data must
+	// also match.
+	Type  string      `json:"Type,omitempty"`
+	Value interface{} `json:"Value,omitempty"`
 }
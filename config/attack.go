@@ -0,0 +1,65 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Velocidex/yaml/v2"
+
+	_ "embed"
+)
+
+//go:embed attack.yaml
+var default_attack string
+
+// ATT&CK technique and sub-technique ids (e.g. T1547 or T1547.001)
+var TechniqueRegex = regexp.MustCompile(`^T[0-9]{4}(\.[0-9]{3})?$`)
+
+type Technique struct {
+	Id   string `json:"Id"`
+	Name string `json:"Name"`
+}
+
+// The parent technique of a sub-technique (e.g. T1547 for
+// T1547.001) or the technique itself.
+func (self *Technique) Parent() string {
+	return strings.Split(self.Id, ".")[0]
+}
+
+// The ATT&CK techniques rules may refer to.
+type Attack struct {
+	// The ATT&CK version the techniques were taken from.
+	Version    string      `json:"Version"`
+	Techniques []Technique `json:"Techniques"`
+
+	by_id map[string]*Technique
+}
+
+// The techniques built into the binary (attack.yaml).
+func DefaultAttack() *Attack {
+	attack, err := LoadAttack([]byte(default_attack))
+	if err != nil {
+		panic(err)
+	}
+	return attack
+}
+
+func LoadAttack(data []byte) (*Attack, error) {
+	attack := &Attack{}
+	err := yaml.UnmarshalStrict(data, attack)
+	if err != nil {
+		return nil, err
+	}
+
+	attack.by_id = make(map[string]*Technique)
+	for i := range attack.Techniques {
+		t := &attack.Techniques[i]
+		attack.by_id[t.Id] = t
+	}
+	return attack, nil
+}
+
+// Find a technique by its id. Returns nil for unknown techniques.
+func (self *Attack) Technique(id string) *Technique {
+	return self.by_id[strings.ToUpper(id)]
+}
@@ -0,0 +1,406 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Velocidex/yaml/v2"
+
+	_ "embed"
+)
+
+const (
+	// The strategy mounting every hive from its file. This is how
+	// "reghunter run" mounts the hives.
+	RAW_HIVES_STRATEGY = "Raw Hives"
+
+	// The first component of the path of user hives is the user
+	// name.
+	USER_PLACEHOLDER = "%USER%"
+
+	DEFAULT_MOUNT_ACCESSOR = "registry"
+
+	// The keys user hives are mounted under (the UserHiveKey
+	// parameter).
+	USER_KEY_USERNAME = "Username"
+	USER_KEY_SID      = "SID"
+	USER_KEY_BOTH     = "Both"
+
+	// The values of the ControlSets key selecting a control set, in
+	// the order rows are tagged with them.
+	CONTROL_SET_CURRENT         = "Current"
+	CONTROL_SET_LAST_KNOWN_GOOD = "LastKnownGood"
+	CONTROL_SET_FAILED          = "Failed"
+
+	// The tag of control sets none of the values select.
+	CONTROL_SET_ORPHANED = "Orphaned"
+)
+
+//go:embed mounts.yaml
+var default_mounts string
+
+// Placeholders (e.g. %USER%) match a path component of user hives and
+// are replaced with it in the registry path.
+var PlaceholderRegex = regexp.MustCompile(`%[A-Z]+%`)
+
+// The keys of the control sets (e.g. ControlSet001)
+var ControlSetRegex = regexp.MustCompile(`(?i)^ControlSet[0-9]+$`)
+
+var ControlSetRoles = []string{
+	CONTROL_SET_CURRENT, CONTROL_SET_LAST_KNOWN_GOOD, CONTROL_SET_FAILED}
+
+// A RemappingStrategy of the artifact.
+type Strategy struct {
+	Name        string `json:"Name"`
+	Description string `json:"Description,omitempty"`
+
+	// The live registry is mapped through the API and the hive
+	// mounts are added on top of it.
+	API bool `json:"API,omitempty"`
+}
+
+// A hive file mounted into the registry.
+type Mount struct {
+	Description string `json:"Description,omitempty"`
+
+	// Where to mount the hive (defaults to the hive's Root)
+	RegistryPath string `json:"RegistryPath,omitempty"`
+
+	// The key inside the hive to mount (defaults to /)
+	KeyPath string `json:"KeyPath,omitempty"`
+
+	// Mount the control set selected by this value of the
+	// ControlSets key (e.g. Current) instead of KeyPath.
+	ControlSet string `json:"ControlSet,omitempty"`
+
+	// The accessor to mount the hive on (defaults to registry)
+	Accessor string `json:"Accessor,omitempty"`
+
+	// The strategies using this mount.
+	Strategies []string `json:"Strategies"`
+}
+
+type Hive struct {
+	// The RECmd HiveType
+	Name string `json:"Name"`
+
+	// The artifact parameter overriding the location of the hive.
+	Parameter string `json:"Parameter,omitempty"`
+
+	// The hive file relative to the root drive, or for user hives,
+	// relative to the users directory. The path of user hives
+	// starts with %USER% and may contain other placeholders.
+	Path    string `json:"Path,omitempty"`
+	PerUser bool   `json:"PerUser,omitempty"`
+
+	// Where rules find the hive in the registry accessor.
+	Root string `json:"Root"`
+
+	Mounts []Mount `json:"Mounts,omitempty"`
+}
+
+// The key listing the user profiles, used to find the SID of each
+// user.
+type ProfileList struct {
+	Hive string `json:"Hive"`
+	Key  string `json:"Key"`
+}
+
+// The key of a system hive selecting its control sets (Select). Its
+// values hold the number of the current, last known good and failed
+// control sets.
+type ControlSets struct {
+	Hive string `json:"Hive"`
+	Key  string `json:"Key"`
+}
+
+// How the hives of the Volume Shadow Copies are mounted when they
+// are swept: the mounts of Strategy on the registry accessor, below
+// Prefix\<shadow copy id>.
+type ShadowCopies struct {
+	Prefix   string `json:"Prefix"`
+	Strategy string `json:"Strategy"`
+}
+
+// Describes where the hives are found and where they are mounted.
+type Mounts struct {
+	Strategies      []Strategy `json:"Strategies"`
+	DefaultStrategy string     `json:"DefaultStrategy"`
+
+	// The directory containing the user profiles relative to the
+	// root drive.
+	UsersPath string `json:"UsersPath"`
+
+	ProfileList ProfileList `json:"ProfileList"`
+
+	ControlSets ControlSets `json:"ControlSets"`
+
+	ShadowCopies ShadowCopies `json:"ShadowCopies"`
+
+	Hives []Hive `json:"Hives"`
+}
+
+// The mounts built into the binary (mounts.yaml).
+func DefaultMounts() *Mounts {
+	mounts, err := LoadMounts([]byte(default_mounts))
+	if err != nil {
+		panic(err)
+	}
+	return mounts
+}
+
+func LoadMounts(data []byte) (*Mounts, error) {
+	mounts := &Mounts{}
+	err := yaml.UnmarshalStrict(data, mounts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range mounts.Hives {
+		hive := &mounts.Hives[i]
+		for j := range hive.Mounts {
+			m := &hive.Mounts[j]
+			if m.RegistryPath == "" {
+				m.RegistryPath = hive.Root
+			}
+			if m.KeyPath == "" {
+				m.KeyPath = "/"
+			}
+			if m.Accessor == "" {
+				m.Accessor = DEFAULT_MOUNT_ACCESSOR
+			}
+		}
+	}
+
+	return mounts, mounts.validate()
+}
+
+func (self *Mounts) validate() error {
+	strategies := make(map[string]bool)
+	for _, s := range self.Strategies {
+		if strategies[s.Name] {
+			return fmt.Errorf("Duplicate strategy %v", s.Name)
+		}
+		strategies[s.Name] = true
+	}
+
+	if !strategies[self.DefaultStrategy] {
+		return fmt.Errorf("Unknown default strategy %v", self.DefaultStrategy)
+	}
+
+	names := make(map[string]bool)
+	for _, hive := range self.Hives {
+		name := strings.ToUpper(hive.Name)
+		if names[name] {
+			return fmt.Errorf("Duplicate hive %v", hive.Name)
+		}
+		names[name] = true
+
+		if hive.PerUser != strings.HasPrefix(hive.Path, USER_PLACEHOLDER+"/") {
+			return fmt.Errorf("Hive %v: Only the path of user hives starts with %v",
+				hive.Name, USER_PLACEHOLDER)
+		}
+
+		placeholders := hive.Placeholders()
+		for _, path := range append([]string{hive.Root}, hive.registryPaths()...) {
+			for _, p := range PlaceholderRegex.FindAllString(path, -1) {
+				if placeholders[p] == 0 {
+					return fmt.Errorf("Hive %v: %v is not in the hive path",
+						hive.Name, p)
+				}
+			}
+		}
+
+		if hive.Path == "" && len(hive.Mounts) > 0 {
+			return fmt.Errorf("Hive %v: Only hive files can be mounted", hive.Name)
+		}
+
+		if hive.Path != "" && !hive.PerUser && hive.Parameter == "" {
+			return fmt.Errorf("Hive %v: No Parameter for the hive path", hive.Name)
+		}
+
+		for _, m := range hive.Mounts {
+			for _, s := range m.Strategies {
+				if !strategies[s] {
+					return fmt.Errorf("Hive %v: Unknown strategy %v", hive.Name, s)
+				}
+			}
+
+			if m.ControlSet == "" {
+				continue
+			}
+
+			if !strings.EqualFold(hive.Name, self.ControlSets.Hive) {
+				return fmt.Errorf("Hive %v: Only the %v hive has control sets",
+					hive.Name, self.ControlSets.Hive)
+			}
+
+			if !isControlSetRole(m.ControlSet) {
+				return fmt.Errorf("Hive %v: Unknown control set %v",
+					hive.Name, m.ControlSet)
+			}
+
+			if m.KeyPath != "/" {
+				return fmt.Errorf("Hive %v: Mount has both a KeyPath and a ControlSet",
+					hive.Name)
+			}
+		}
+	}
+
+	hive, err := self.Hive(self.ProfileList.Hive)
+	if err != nil {
+		return fmt.Errorf("ProfileList: %w", err)
+	}
+
+	if hive.Path == "" || hive.PerUser {
+		return fmt.Errorf("ProfileList: Hive %v is not a system hive", hive.Name)
+	}
+
+	hive, err = self.Hive(self.ControlSets.Hive)
+	if err != nil {
+		return fmt.Errorf("ControlSets: %w", err)
+	}
+
+	if hive.Path == "" || hive.PerUser {
+		return fmt.Errorf("ControlSets: Hive %v is not a system hive", hive.Name)
+	}
+
+	if self.ShadowCopies.Prefix == "" {
+		return fmt.Errorf("ShadowCopies: No Prefix")
+	}
+
+	if !strategies[self.ShadowCopies.Strategy] {
+		return fmt.Errorf("ShadowCopies: Unknown strategy %v",
+			self.ShadowCopies.Strategy)
+	}
+
+	return nil
+}
+
+// The roots of the user hives. The user is the key directly below
+// the root.
+func (self *Mounts) UserRoots() []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, hive := range self.Hives {
+		root, _ := hive.SplitRoot()
+		if hive.PerUser && !seen[root] &&
+			strings.HasPrefix(hive.Root, root+"\\"+USER_PLACEHOLDER) {
+			seen[root] = true
+			result = append(result, root)
+		}
+	}
+	return result
+}
+
+// The roots rules may use: the Root of every hive. User hives are
+// found under the part of their Root before the first placeholder
+// (e.g. HKEY_USERS).
+func (self *Mounts) Roots() []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, hive := range self.Hives {
+		root, _ := hive.SplitRoot()
+		if !seen[root] {
+			seen[root] = true
+			result = append(result, root)
+		}
+	}
+	return result
+}
+
+// Find a hive by its RECmd HiveType.
+func (self *Mounts) Hive(name string) (*Hive, error) {
+	for i := range self.Hives {
+		if strings.EqualFold(self.Hives[i].Name, name) {
+			return &self.Hives[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown hive '%v'", name)
+}
+
+// The placeholders in the path of a user hive and the index of the
+// path component they match, counted from the end (e.g. %USER% is
+// -2 in %USER%/NTUser.dat)
+func (self *Hive) Placeholders() map[string]int {
+	result := make(map[string]int)
+	if !self.PerUser {
+		return result
+	}
+
+	components := strings.Split(self.Path, "/")
+	for i, c := range components {
+		if PlaceholderRegex.MatchString(c) {
+			result[c] = i - len(components)
+		}
+	}
+	return result
+}
+
+// The glob matching user hives.
+func (self *Hive) Glob() string {
+	return PlaceholderRegex.ReplaceAllString(self.Path, "*")
+}
+
+func (self *Hive) registryPaths() []string {
+	var result []string
+	for _, m := range self.Mounts {
+		result = append(result, m.RegistryPath)
+	}
+	return result
+}
+
+// Splits the Root of the hive into the rule root and a glob prefix
+// (e.g. HKEY_USERS and *\Software\Classes\ for user class hives).
+func (self *Hive) SplitRoot() (root string, glob string) {
+	idx := PlaceholderRegex.FindStringIndex(self.Root)
+	if idx == nil {
+		return self.Root, ""
+	}
+
+	glob = PlaceholderRegex.ReplaceAllString(self.Root[idx[0]:], "*")
+	return strings.TrimSuffix(self.Root[:idx[0]], "\\"), glob + "\\"
+}
+
+// Replace the placeholders with the path components they matched.
+func Expand(path string, values map[string]string) string {
+	return PlaceholderRegex.ReplaceAllStringFunc(path, func(p string) string {
+		return values[p]
+	})
+}
+
+// The mounts of the shadow copies: the mounts of their strategy on
+// the registry accessor.
+func (self *Hive) ShadowCopyMounts(shadow_copies ShadowCopies) []Mount {
+	var result []Mount
+	if self.Path == "" {
+		return nil
+	}
+
+	for _, m := range self.Mounts {
+		if m.Uses(shadow_copies.Strategy) &&
+			m.Accessor == DEFAULT_MOUNT_ACCESSOR {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func (self *Mount) Uses(strategy string) bool {
+	for _, s := range self.Strategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+func isControlSetRole(name string) bool {
+	for _, role := range ControlSetRoles {
+		if role == name {
+			return true
+		}
+	}
+	return false
+}
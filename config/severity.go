@@ -0,0 +1,38 @@
+package config
+
+import "strings"
+
+// How important a hit of the rule is.
+const (
+	RULE_SEVERITY_INFO   = "info"
+	RULE_SEVERITY_LOW    = "low"
+	RULE_SEVERITY_MEDIUM = "medium"
+	RULE_SEVERITY_HIGH   = "high"
+)
+
+// Inventory rules describe the system (e.g. installed software) while
+// each hit of a detection rule is a finding an analyst should look
+// at.
+const (
+	RULE_KIND_INVENTORY = "inventory"
+	RULE_KIND_DETECTION = "detection"
+)
+
+// The severities from the least to the most important.
+var RuleSeverities = []string{
+	RULE_SEVERITY_INFO, RULE_SEVERITY_LOW,
+	RULE_SEVERITY_MEDIUM, RULE_SEVERITY_HIGH,
+}
+
+var RuleKinds = []string{RULE_KIND_INVENTORY, RULE_KIND_DETECTION}
+
+// The rank of the severity so severities can be compared. Returns -1
+// for unknown severities.
+func SeverityLevel(severity string) int {
+	for i, s := range RuleSeverities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,11 @@
+package config
+
+import (
+	_ "embed"
+)
+
+// The source of the rule file types. The rule schema takes the field
+// descriptions from their comments.
+//
+//go:embed api.go
+var APISource string
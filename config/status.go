@@ -0,0 +1,12 @@
+package config
+
+// The lifecycle of a rule.
+const (
+	RULE_STATUS_EXPERIMENTAL = "experimental"
+	RULE_STATUS_STABLE       = "stable"
+	RULE_STATUS_DEPRECATED   = "deprecated"
+)
+
+var RuleStatuses = []string{
+	RULE_STATUS_EXPERIMENTAL, RULE_STATUS_STABLE, RULE_STATUS_DEPRECATED,
+}
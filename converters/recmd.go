@@ -8,6 +8,7 @@ import (
 
 	"github.com/Velocidex/registry_hunter/config"
 	"github.com/Velocidex/yaml/v2"
+	"github.com/google/uuid"
 )
 
 // Description of fields are documented in !RECmdBatch.guide
@@ -49,6 +50,8 @@ type KeyDescription struct {
 type RECmdBatch struct {
 	Description string           `json:"Description"`
 	Author      string           `json:"Author"`
+	Version     string           `json:"Version"`
+	Id          string           `json:"Id"`
 	Keys        []KeyDescription `json:"Keys"`
 	Disabled    bool             `json:"Disabled"`
 	Preamble    []string         `json:"Preamble,omitempty"`
@@ -63,6 +66,14 @@ type RECmdConverter struct {
 	batch_files []*RECmdBatch
 	errors      []RuleError
 
+	// The rule IDs given so far
+	ids map[string]bool
+
+	// Detect keys repeated in the same batch
+	definitions map[string]bool
+
+	mounts *config.Mounts
+
 	output config.RuleFile
 }
 
@@ -76,7 +87,11 @@ func (self *RECmdConverter) Dump() string {
 }
 
 func NewConverter() *RECmdConverter {
-	return &RECmdConverter{}
+	return &RECmdConverter{
+		ids:         make(map[string]bool),
+		definitions: make(map[string]bool),
+		mounts:      config.DefaultMounts(),
+	}
 }
 
 func (self *RECmdConverter) rejectRule(description, reason string) {
@@ -109,20 +124,24 @@ func (self *RECmdConverter) ParseYaml(data, path string) error {
 	self.output.Preamble = append(self.output.Preamble, batch_file.Preamble...)
 
 	for _, key := range batch_file.Keys {
-		if key.Disabled {
-			continue
-		}
-
 		rule := config.RegistryRule{
 			Author:      batch_file.Author,
 			Description: key.Description,
 			Comment:     key.Comment,
 			Category:    key.Category,
+			Version:     batch_file.Version,
 			Filter:      key.Filter,
 			Preamble:    key.Preamble,
 		}
 
-		err := mapHive(key.HiveType, &rule)
+		// Disabled keys are kept so they may be enabled later, but
+		// the compiler ignores them.
+		if key.Disabled {
+			rule.Disabled = true
+			rule.DisabledReason = "Disabled in the RECmd batch file"
+		}
+
+		err := self.mapHive(key.HiveType, &rule)
 		if err != nil {
 			self.rejectRule(key.Description,
 				fmt.Sprintf("While processing %v: %v", key.Description, err))
@@ -156,12 +175,56 @@ func (self *RECmdConverter) ParseYaml(data, path string) error {
 				}
 			}
 		}
+
+		definition := keyDefinition(batch_file.Id, &key)
+		if self.definitions[definition] {
+			self.rejectRule(key.Description,
+				fmt.Sprintf("While processing %v: Duplicate key in batch %v",
+					key.Description, batch_file.Id))
+			continue
+		}
+		self.definitions[definition] = true
+
+		// Keys at the same location (e.g. with different Filters)
+		// would get the same ID. The ID must not depend on the order
+		// of the keys so these are rejected.
+		rule.Id = ruleId(batch_file.Id, &key)
+		if self.ids[rule.Id] {
+			self.rejectRule(key.Description,
+				fmt.Sprintf("While processing %v: Key location already used by another key in batch %v",
+					key.Description, batch_file.Id))
+			continue
+		}
+		self.ids[rule.Id] = true
+
 		self.output.Rules = append(self.output.Rules, rule)
 	}
 
 	return nil
 }
 
+// Batch files have an Id but the individual keys do not. We derive a
+// stable ID for each rule from the batch Id and the location of the
+// key so it does not change when keys are reordered or their
+// Description is reworded.
+func ruleId(batch_id string, key *KeyDescription) string {
+	namespace, err := uuid.Parse(batch_id)
+	if err != nil {
+		namespace = uuid.NewSHA1(uuid.Nil, []byte(batch_id))
+	}
+
+	return uuid.NewSHA1(namespace, []byte(strings.Join([]string{
+		key.HiveType, key.KeyPath, key.ValueName,
+		fmt.Sprintf("%v", key.Recursive)}, "\x00"))).String()
+}
+
+// Keys repeated verbatim in a batch are rejected.
+func keyDefinition(batch_id string, key *KeyDescription) string {
+	return strings.Join([]string{batch_id, key.Description,
+		key.HiveType, key.KeyPath, key.ValueName,
+		fmt.Sprintf("%v", key.Recursive)}, "\x00")
+}
+
 func escapeQuotes(in string) string {
 	if strings.Contains(in, "\"") {
 		return "\"" + strings.Replace(in, "\"", "\\\"", -1) + "\""
@@ -186,54 +249,17 @@ func validateBinaryConvert(name string, rule *config.RegistryRule) error {
 	return nil
 }
 
-// Map the hive into the remapped registry space. This needs to
-// correspond with the remapping created via the compiler's remapping
-// strategies.
-func mapHive(name string, rule *config.RegistryRule) error {
-
-	switch strings.ToUpper(name) {
-	case "USERS":
-		rule.Root = "HKEY_USERS"
-
-	case "NTUSER":
-		// Rely on mapping C:\Users\*\NTUSER.Dat
-		rule.Root = "HKEY_USERS"
-		rule.Glob = "*\\"
-
-	case "SYSTEM":
-		// Rely on mapping C:\Windows\System32\config\SYSTEM
-		rule.Root = "HKEY_LOCAL_MACHINE\\System"
-
-	case "SECURITY":
-		// Rely on mapping C:\Windows\System32\config\SECURITY
-		rule.Root = "HKEY_LOCAL_MACHINE\\Security"
-
-	case "SOFTWARE":
-		// Rely on mapping C:\Windows\System32\config\SOFTWARE
-		rule.Root = "HKEY_LOCAL_MACHINE\\Software"
-
-	case "SAM":
-		// Rely on mapping C:\Windows\System32\config\SAM
-		rule.Root = "SAM"
-
-	case "USRCLASS":
-		// Rely on mapping C:\Users\*\UserClass.Dat
-		rule.Root = "HKEY_USERS"
-		rule.Glob = "*\\Software\\Classes"
-
-		// The BCD hive file is usually located in the boot partition
-		// so we can not remap the raw map. We need to rely on the API
-		// to remap it.
-	case "BCD":
-		rule.Root = "HKEY_LOCAL_MACHINE\\BCD00000000"
-
-	case "AMCACHE":
-		rule.Root = "Amcache"
-
-	default:
-		return fmt.Errorf("Unknown hive '%v'", name)
+// Map the hive into the remapped registry space. The hive types and
+// their mount points are defined by the compiler's mounts (see
+// config/mounts.yaml).
+func (self *RECmdConverter) mapHive(name string, rule *config.RegistryRule) error {
+	hive, err := self.mounts.Hive(name)
+	if err != nil {
+		return err
 	}
 
+	// User hives are globbed under HKEY_USERS
+	rule.Root, rule.Glob = hive.SplitRoot()
 	return nil
 }
 
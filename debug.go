@@ -11,6 +11,6 @@ func Debug(arg interface{}) {
 }
 
 func JsonDump(arg interface{}) string {
-	serialized, _ := json.MarshalIndent(arg)
+	serialized, _ := json.MarshalIndent(arg, "", " ")
 	return string(serialized)
 }
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Velocidex/registry_hunter/config"
+)
+
+// The control sets of the SYSTEM hive selected by the values of its
+// Select key, similar to _ReadControlSets in the artifact template.
+type controlSets struct {
+	// The control set names by the value selecting them (e.g.
+	// Current=ControlSet002)
+	selected map[string]string
+
+	// The root of the hive (e.g. HKEY_LOCAL_MACHINE\System)
+	root []string
+}
+
+func newControlSets() *controlSets {
+	return &controlSets{
+		selected: make(map[string]string),
+	}
+}
+
+func controlSetName(number uint64) string {
+	return fmt.Sprintf("ControlSet%03d", number)
+}
+
+// Read the Select key from the raw hive.
+func (self *Registry) loadControlSets(paths *HivePaths) {
+	hive_info, err := paths.Mounts.Hive(paths.Mounts.ControlSets.Hive)
+	if err != nil {
+		return
+	}
+	self.control_sets.root = SplitPath(hive_info.Root)
+
+	path, err := findFileNoCase(paths.Paths[hive_info.Parameter])
+	if err != nil {
+		return
+	}
+
+	hive, err := self.openHive(path)
+	if err != nil {
+		return
+	}
+
+	root, err := hive.Root()
+	if err != nil {
+		return
+	}
+
+	select_key := root.OpenPath(paths.Mounts.ControlSets.Key)
+	if select_key == nil {
+		return
+	}
+
+	for _, role := range config.ControlSetRoles {
+		value := select_key.Value(role)
+		if value == nil {
+			continue
+		}
+
+		number, ok := value.Decode().(uint64)
+		if ok {
+			self.control_sets.selected[role] = controlSetName(number)
+		}
+	}
+}
+
+// The control set selected by the value (e.g. Current), falling back
+// to ControlSet001.
+func (self *controlSets) name(role string) string {
+	name, pres := self.selected[role]
+	if !pres {
+		return controlSetName(1)
+	}
+	return name
+}
+
+// Tag keys below a control set with the value selecting it. Returns
+// nil for keys outside the control sets or when the hive has no
+// Select key.
+func (self *controlSets) role(components []string) interface{} {
+	if self.selected[config.CONTROL_SET_CURRENT] == "" ||
+		len(components) <= len(self.root) ||
+		!strings.EqualFold(JoinPath(components[:len(self.root)]),
+			JoinPath(self.root)) {
+		return nil
+	}
+
+	name := components[len(self.root)]
+	if !config.ControlSetRegex.MatchString(name) {
+		return nil
+	}
+
+	for _, role := range config.ControlSetRoles {
+		if strings.EqualFold(self.selected[role], name) {
+			return role
+		}
+	}
+	return config.CONTROL_SET_ORPHANED
+}
@@ -0,0 +1,131 @@
+// Package executor runs registry hunter rules natively over raw hive
+// files. Only the Glob part of the rule is evaluated - the Details
+// VQL requires a Velociraptor binary so the raw data is emitted
+// instead.
+package executor
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/Velocidex/registry_hunter/config"
+)
+
+var (
+	UnsupportedRuleError = errors.New("Unsupported rule")
+
+	spaceRegex = regexp.MustCompile(`\s+`)
+)
+
+type filterFunc func(e *Entry) bool
+
+type RuleError struct {
+	Description string
+	Error       string
+}
+
+type Executor struct {
+	registry *Registry
+	errors   []RuleError
+}
+
+func NewExecutor(registry *Registry) *Executor {
+	return &Executor{registry: registry}
+}
+
+func (self *Executor) rejectRule(description, reason string) {
+	self.errors = append(self.errors, RuleError{
+		Description: description,
+		Error:       reason,
+	})
+}
+
+func (self *Executor) Errors() []RuleError {
+	return self.errors
+}
+
+// Only the most common VQL filters can be evaluated natively.
+func parseFilter(filter string) (filterFunc, error) {
+	normalized := strings.ToLower(spaceRegex.ReplaceAllString(
+		strings.TrimSpace(filter), " "))
+
+	switch normalized {
+	case "", "x=>not isdir", "x=>not x.isdir":
+		return func(e *Entry) bool { return !e.IsDir }, nil
+
+	case "x=>isdir", "x=>x.isdir":
+		return func(e *Entry) bool { return e.IsDir }, nil
+
+	case "x=>true":
+		return func(e *Entry) bool { return true }, nil
+	}
+
+	return nil, UnsupportedRuleError
+}
+
+// Check if the rule can be evaluated natively.
+func Supported(rule *config.RegistryRule) error {
+	if rule.Query != "" {
+		return errors.New("Full VQL queries are not supported")
+	}
+
+	_, err := parseFilter(rule.Filter)
+	if err != nil {
+		return errors.New("Filter " + rule.Filter + " is not supported")
+	}
+	return nil
+}
+
+// Run all the rules, calling cb with each result row.
+func (self *Executor) Run(
+	rules []config.RegistryRule, cb func(row *ordereddict.Dict)) {
+	for _, rule := range rules {
+		err := Supported(&rule)
+		if err != nil {
+			self.rejectRule(rule.Description, err.Error())
+			continue
+		}
+
+		filter, _ := parseFilter(rule.Filter)
+		emit := func(registry *Registry, e *Entry) {
+			sid, username := registry.profiles.identify(e.Components)
+			cb(ordereddict.NewDict().
+				Set("RuleId", rule.Id).
+				Set("Description", rule.Description).
+				Set("Category", rule.Category).
+				Set("Severity", rule.Severity).
+				Set("Kind", rule.Kind).
+				Set("OSPath", e.OSPath()).
+				Set("Mtime", e.Mtime.UTC().Format(time.RFC3339)).
+				Set("UserSID", sid).
+				Set("Username", username).
+				Set("ControlSet", registry.control_sets.role(e.Components)).
+				Set("Replayed", e.Replayed).
+				Set("Deleted", e.Deleted).
+				Set("Data", e.Data()))
+		}
+
+		err = self.registry.Glob(rule.Root, rule.AllGlobs(), func(e *Entry) {
+			if filter(e) {
+				emit(self.registry, e)
+			}
+		})
+
+		// Add the rows recovered from the transaction logs to the
+		// rows of the primary hives.
+		replayed := self.registry.replayed
+		if err == nil && replayed != nil {
+			err = replayed.Glob(rule.Root, rule.AllGlobs(), func(e *Entry) {
+				if e.Replayed && filter(e) {
+					emit(replayed, e)
+				}
+			})
+		}
+		if err != nil {
+			self.rejectRule(rule.Description, err.Error())
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/Velocidex/registry_hunter/config"
+	"github.com/Velocidex/registry_hunter/regf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	systemHive = &regf.HiveSpec{
+		LastWritten: "2024-01-02T03:04:05Z",
+		Root: regf.KeySpec{
+			Keys: []regf.KeySpec{{
+				Name: "ControlSet001",
+				Keys: []regf.KeySpec{{
+					Name: "Services",
+					Keys: []regf.KeySpec{{
+						Name: "Rclone",
+						Values: []regf.ValueSpec{
+							{Name: "ImagePath", Data: `C:\rclone.exe`},
+							{Name: "Start", Type: "REG_DWORD", Data: 2},
+						},
+					}},
+				}},
+			}},
+		},
+	}
+
+	ntuserHive = &regf.HiveSpec{
+		LastWritten: "2024-01-02T03:04:05Z",
+		Root: regf.KeySpec{
+			Keys: []regf.KeySpec{{
+				Name: "Software",
+				Keys: []regf.KeySpec{{
+					Name: "Microsoft",
+					Keys: []regf.KeySpec{{
+						Name: "Run",
+						Values: []regf.ValueSpec{
+							{Name: "Updater", Data: `C:\Temp\evil.exe`},
+						},
+					}},
+				}, {
+					// Will be hidden by the UsrClass.dat mount
+					Name: "Classes",
+					Keys: []regf.KeySpec{{Name: "Hidden"}},
+				}},
+			}},
+		},
+	}
+
+	softwareHive = &regf.HiveSpec{
+		Root: regf.KeySpec{
+			Keys: []regf.KeySpec{{
+				Name: "Microsoft",
+				Keys: []regf.KeySpec{{
+					Name: "Windows NT",
+					Keys: []regf.KeySpec{{
+						Name: "CurrentVersion",
+						Keys: []regf.KeySpec{{
+							Name: "ProfileList",
+							Keys: []regf.KeySpec{{
+								Name: "S-1-5-21-1-1001",
+								Values: []regf.ValueSpec{{
+									Name: "ProfileImagePath",
+									Type: "REG_EXPAND_SZ",
+									Data: `%SystemDrive%\Users\User1`,
+								}},
+							}},
+						}},
+					}},
+				}},
+			}},
+		},
+	}
+
+	usrclassHive = &regf.HiveSpec{
+		Root: regf.KeySpec{
+			Keys: []regf.KeySpec{{
+				Name: "CLSID",
+				Values: []regf.ValueSpec{
+					{Name: "@", Data: "Default"},
+				},
+			}},
+		},
+	}
+)
+
+func writeHive(t *testing.T, spec *regf.HiveSpec, path ...string) {
+	filename := filepath.Join(path...)
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0700))
+	require.NoError(t, regf.WriteHiveFile(spec, filename))
+}
+
+func runRules(t *testing.T, registry *Registry,
+	rules []config.RegistryRule) []string {
+	result := []string{}
+	NewExecutor(registry).Run(rules, func(row *ordereddict.Dict) {
+		serialized, err := json.Marshal(row)
+		require.NoError(t, err)
+		result = append(result, string(serialized))
+	})
+	return result
+}
+
+func TestExecutor(t *testing.T) {
+	root_drive := t.TempDir()
+
+	// Hives are usually found case insensitively.
+	writeHive(t, systemHive, root_drive, "Windows/System32/config/SYSTEM")
+	writeHive(t, ntuserHive, root_drive, "Users/user1/NTUSER.DAT")
+	writeHive(t, usrclassHive, root_drive,
+		"Users/user1/AppData/Local/Microsoft/Windows/UsrClass.dat")
+	writeHive(t, usrclassHive, root_drive,
+		"Users/user1/AppData/Local/Packages/App1/Settings/settings.dat")
+
+	registry := NewRegistry()
+	errors := 0
+	mounted := []string{}
+	for _, m := range registry.MountHives(DefaultHivePaths(root_drive)) {
+		if m.Error != "" {
+			errors++
+		} else {
+			mounted = append(mounted, m.RegistryPath)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"HKEY_LOCAL_MACHINE\\System\\CurrentControlSet",
+		"HKEY_LOCAL_MACHINE\\System",
+		"HKEY_USERS\\user1",
+		"HKEY_USERS\\user1\\Software\\Classes",
+		"UWPSettings\\user1\\App1",
+	}, mounted)
+
+	// Software, Security, SAM, Amcache, DEFAULT, COMPONENTS, DRIVERS,
+	// BBI, ELAM and Syscache are missing.
+	assert.Equal(t, 10, errors)
+
+	assert.Equal(t, []string{
+		`{"RuleId":"services","Description":"Services","Category":"Services","Severity":"high","Kind":"detection","OSPath":"HKEY_LOCAL_MACHINE\\System\\CurrentControlSet\\Services\\Rclone\\ImagePath","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":null,"ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\rclone.exe"}}`,
+		`{"RuleId":"services","Description":"Services","Category":"Services","Severity":"high","Kind":"detection","OSPath":"HKEY_LOCAL_MACHINE\\System\\CurrentControlSet\\Services\\Rclone\\Start","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":null,"ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_DWORD","value":2}}`,
+	}, runRules(t, registry, []config.RegistryRule{{
+		Id:          "services",
+		Description: "Services",
+		Category:    "Services",
+		Severity:    "high",
+		Kind:        "detection",
+		Root:        "HKEY_LOCAL_MACHINE\\System",
+		Glob:        "CurrentControlSet\\Services\\*\\*",
+	}}))
+
+	assert.Equal(t, []string{
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_USERS\\user1\\Software\\Microsoft\\Run\\Updater","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":"user1","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\Temp\\evil.exe"}}`,
+	}, runRules(t, registry, []config.RegistryRule{{
+		Id:          "run-keys",
+		Description: "Run Keys",
+		Category:    "ASEP",
+		Root:        "HKEY_USERS",
+		Glob:        "*\\Software\\**\\Run\\*",
+	}}))
+
+	// The UsrClass.dat hive is mounted over Software\Classes
+	assert.Equal(t, []string{
+		`{"RuleId":"classes","Description":"Classes","Category":"Misc","Severity":"","Kind":"","OSPath":"HKEY_USERS\\user1\\Software\\Classes\\CLSID","Mtime":"1601-01-01T00:00:00Z","UserSID":null,"Username":"user1","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"Key"}}`,
+		`{"RuleId":"classes","Description":"Classes","Category":"Misc","Severity":"","Kind":"","OSPath":"HKEY_USERS\\user1\\Software\\Classes\\CLSID\\@","Mtime":"1601-01-01T00:00:00Z","UserSID":null,"Username":"user1","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"Default"}}`,
+	}, runRules(t, registry, []config.RegistryRule{{
+		Id:          "classes",
+		Description: "Classes",
+		Category:    "Misc",
+		Root:        "HKEY_USERS",
+		Glob:        "*\\Software\\Classes\\**",
+		Filter:      "x=>true",
+	}}))
+
+	// Full queries can not be run natively.
+	executor := NewExecutor(registry)
+	executor.Run([]config.RegistryRule{{
+		Description: "WMI",
+		Query:       "SELECT * FROM wmi()",
+	}}, func(row *ordereddict.Dict) {})
+	assert.Equal(t, 1, len(executor.Errors()))
+}
+
+func TestUserSIDs(t *testing.T) {
+	root_drive := t.TempDir()
+	writeHive(t, softwareHive, root_drive, "Windows/System32/config/SOFTWARE")
+	writeHive(t, ntuserHive, root_drive, "Users/user1/NTUSER.DAT")
+	writeHive(t, ntuserHive, root_drive, "Users/user2/NTUSER.DAT")
+
+	run_keys := []config.RegistryRule{{
+		Id:          "run-keys",
+		Description: "Run Keys",
+		Category:    "ASEP",
+		Root:        "HKEY_USERS",
+		Glob:        "*\\Software\\Microsoft\\Run\\*",
+	}}
+
+	// By default the hives are mounted under the folder name but the
+	// rows still identify the user.
+	registry := NewRegistry()
+	registry.MountHives(DefaultHivePaths(root_drive))
+	assert.Equal(t, []string{
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_USERS\\user1\\Software\\Microsoft\\Run\\Updater","Mtime":"2024-01-02T03:04:05Z","UserSID":"S-1-5-21-1-1001","Username":"user1","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\Temp\\evil.exe"}}`,
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_USERS\\user2\\Software\\Microsoft\\Run\\Updater","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":"user2","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\Temp\\evil.exe"}}`,
+	}, runRules(t, registry, run_keys))
+
+	// Users missing from the ProfileList keep their folder name.
+	paths := DefaultHivePaths(root_drive)
+	paths.UserHiveKey = config.USER_KEY_SID
+	registry = NewRegistry()
+	registry.MountHives(paths)
+	assert.Equal(t, []string{
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_USERS\\S-1-5-21-1-1001\\Software\\Microsoft\\Run\\Updater","Mtime":"2024-01-02T03:04:05Z","UserSID":"S-1-5-21-1-1001","Username":"User1","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\Temp\\evil.exe"}}`,
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_USERS\\user2\\Software\\Microsoft\\Run\\Updater","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":"user2","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\Temp\\evil.exe"}}`,
+	}, runRules(t, registry, run_keys))
+
+	paths = DefaultHivePaths(root_drive)
+	paths.UserHiveKey = config.USER_KEY_BOTH
+	registry = NewRegistry()
+	registry.MountHives(paths)
+	assert.Equal(t, []string{
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_USERS\\user1\\Software\\Microsoft\\Run\\Updater","Mtime":"2024-01-02T03:04:05Z","UserSID":"S-1-5-21-1-1001","Username":"user1","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\Temp\\evil.exe"}}`,
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_USERS\\S-1-5-21-1-1001\\Software\\Microsoft\\Run\\Updater","Mtime":"2024-01-02T03:04:05Z","UserSID":"S-1-5-21-1-1001","Username":"User1","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\Temp\\evil.exe"}}`,
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_USERS\\user2\\Software\\Microsoft\\Run\\Updater","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":"user2","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\Temp\\evil.exe"}}`,
+	}, runRules(t, registry, run_keys))
+}
+
+// The DEFAULT hive belongs to LocalSystem rather than a user named
+// .DEFAULT
+func TestDefaultUser(t *testing.T) {
+	root_drive := t.TempDir()
+	writeHive(t, ntuserHive, root_drive, "Windows/System32/config/DEFAULT")
+
+	registry := NewRegistry()
+	registry.MountHives(DefaultHivePaths(root_drive))
+	assert.Equal(t, []string{
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_USERS\\.DEFAULT\\Software\\Microsoft\\Run\\Updater","Mtime":"2024-01-02T03:04:05Z","UserSID":"S-1-5-18","Username":"SYSTEM","ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\Temp\\evil.exe"}}`,
+	}, runRules(t, registry, []config.RegistryRule{{
+		Id:          "run-keys",
+		Description: "Run Keys",
+		Category:    "ASEP",
+		Root:        "HKEY_USERS",
+		Glob:        "*\\Software\\Microsoft\\Run\\*",
+	}}))
+}
+
+func TestTransactionLogs(t *testing.T) {
+	root_drive := t.TempDir()
+	writeHive(t, systemHive, root_drive, "Windows/System32/config/SYSTEM")
+
+	// The Start value was changed to 4 but not yet flushed to the
+	// primary file.
+	primary, err := regf.BuildHive(systemHive)
+	require.NoError(t, err)
+
+	updated_spec := *systemHive
+	updated_spec.Root.Keys = []regf.KeySpec{{
+		Name: "ControlSet001",
+		Keys: []regf.KeySpec{{
+			Name: "Services",
+			Keys: []regf.KeySpec{{
+				Name: "Rclone",
+				Values: []regf.ValueSpec{
+					{Name: "Start", Type: "REG_DWORD", Data: 4},
+				},
+			}},
+		}},
+	}}
+	updated, err := regf.BuildHive(&updated_spec)
+	require.NoError(t, err)
+
+	log, err := regf.BuildLog(primary, updated)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(
+		root_drive, "Windows/System32/config/SYSTEM.LOG1"), log, 0600))
+
+	services := []config.RegistryRule{{
+		Id:          "services",
+		Description: "Services",
+		Category:    "Services",
+		Root:        "HKEY_LOCAL_MACHINE\\System",
+		Glob:        "ControlSet001\\Services\\*\\Start",
+	}}
+
+	run := func(mode string, replayed ...bool) []string {
+		paths := DefaultHivePaths(root_drive)
+		paths.TransactionLogs = mode
+
+		// Only the SYSTEM hive and its CurrentControlSet are mounted.
+		registry := NewRegistry()
+		mounted := []bool{}
+		for _, m := range registry.MountHives(paths) {
+			if m.Error == "" {
+				mounted = append(mounted, m.Replayed)
+			}
+		}
+		assert.Equal(t, replayed, mounted)
+		return runRules(t, registry, services)
+	}
+
+	primary_row := `{"RuleId":"services","Description":"Services","Category":"Services","Severity":"","Kind":"","OSPath":"HKEY_LOCAL_MACHINE\\System\\ControlSet001\\Services\\Rclone\\Start","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":null,"ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_DWORD","value":2}}`
+	replayed_row := `{"RuleId":"services","Description":"Services","Category":"Services","Severity":"","Kind":"","OSPath":"HKEY_LOCAL_MACHINE\\System\\ControlSet001\\Services\\Rclone\\Start","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":null,"ControlSet":null,"Replayed":true,"Deleted":false,"Data":{"type":"REG_DWORD","value":4}}`
+
+	assert.Equal(t, []string{primary_row},
+		run(TRANSACTION_LOGS_PRIMARY, false, false))
+	assert.Equal(t, []string{replayed_row},
+		run(TRANSACTION_LOGS_REPLAYED, true, true))
+
+	// Both the primary and the replayed mounts are reported.
+	assert.Equal(t, []string{primary_row, replayed_row},
+		run(TRANSACTION_LOGS_BOTH, false, false, true, true))
+}
+
+func TestRecoverDeleted(t *testing.T) {
+	root_drive := t.TempDir()
+	writeHive(t, &regf.HiveSpec{
+		LastWritten: "2024-01-02T03:04:05Z",
+		Root: regf.KeySpec{
+			Keys: []regf.KeySpec{{
+				Name: "Microsoft",
+				Keys: []regf.KeySpec{{
+					Name: "Run",
+					Values: []regf.ValueSpec{
+						{Name: "OneDrive", Data: `C:\OneDrive.exe`},
+						{Name: "Updater", Data: `C:\Temp\evil.exe`, Deleted: true},
+					},
+				}, {
+					Name:    "RunOnce",
+					Deleted: true,
+					Values: []regf.ValueSpec{
+						{Name: "Cleanup", Data: `C:\Temp\cleanup.exe`},
+					},
+				}},
+			}},
+		},
+	}, root_drive, "Windows/System32/config/SOFTWARE")
+
+	run_keys := []config.RegistryRule{{
+		Id:          "run-keys",
+		Description: "Run Keys",
+		Category:    "ASEP",
+		Root:        "HKEY_LOCAL_MACHINE\\Software",
+		Globs:       []string{"Microsoft\\Run\\*", "Microsoft\\RunOnce\\*"},
+	}}
+
+	run := func(recover_deleted bool) []string {
+		paths := DefaultHivePaths(root_drive)
+		paths.RecoverDeleted = recover_deleted
+
+		registry := NewRegistry()
+		registry.MountHives(paths)
+		return runRules(t, registry, run_keys)
+	}
+
+	onedrive := `{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_LOCAL_MACHINE\\Software\\Microsoft\\Run\\OneDrive","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":null,"ControlSet":null,"Replayed":false,"Deleted":false,"Data":{"type":"REG_SZ","value":"C:\\OneDrive.exe"}}`
+	assert.Equal(t, []string{onedrive}, run(false))
+
+	// The deleted entries are matched by the same globs.
+	assert.Equal(t, []string{
+		onedrive,
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_LOCAL_MACHINE\\Software\\Microsoft\\Run\\Updater","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":null,"ControlSet":null,"Replayed":false,"Deleted":true,"Data":{"type":"REG_SZ","value":"C:\\Temp\\evil.exe"}}`,
+		`{"RuleId":"run-keys","Description":"Run Keys","Category":"ASEP","Severity":"","Kind":"","OSPath":"HKEY_LOCAL_MACHINE\\Software\\Microsoft\\RunOnce\\Cleanup","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":null,"ControlSet":null,"Replayed":false,"Deleted":true,"Data":{"type":"REG_SZ","value":"C:\\Temp\\cleanup.exe"}}`,
+	}, run(true))
+}
+
+func TestControlSets(t *testing.T) {
+	control_set := func(name string, start int) regf.KeySpec {
+		return regf.KeySpec{
+			Name: name,
+			Keys: []regf.KeySpec{{
+				Name: "Services",
+				Keys: []regf.KeySpec{{
+					Name: "Rclone",
+					Values: []regf.ValueSpec{
+						{Name: "Start", Type: "REG_DWORD", Data: start},
+					},
+				}},
+			}},
+		}
+	}
+
+	root_drive := t.TempDir()
+	writeHive(t, &regf.HiveSpec{
+		LastWritten: "2024-01-02T03:04:05Z",
+		Root: regf.KeySpec{
+			Keys: []regf.KeySpec{
+				control_set("ControlSet001", 2),
+				control_set("ControlSet002", 3),
+				control_set("ControlSet003", 4), {
+					Name: "Select",
+					Values: []regf.ValueSpec{
+						{Name: "Current", Type: "REG_DWORD", Data: 2},
+						{Name: "Default", Type: "REG_DWORD", Data: 2},
+						{Name: "Failed", Type: "REG_DWORD", Data: 0},
+						{Name: "LastKnownGood", Type: "REG_DWORD", Data: 1},
+					},
+				}},
+		},
+	}, root_drive, "Windows/System32/config/SYSTEM")
+
+	registry := NewRegistry()
+	registry.MountHives(DefaultHivePaths(root_drive))
+
+	row := func(path, control_set string, start int) string {
+		return `{"RuleId":"services","Description":"Services","Category":"Services","Severity":"","Kind":"","OSPath":"HKEY_LOCAL_MACHINE\\System\\` +
+			path + `\\Services\\Rclone\\Start","Mtime":"2024-01-02T03:04:05Z","UserSID":null,"Username":null,"ControlSet":` +
+			control_set + `,"Replayed":false,"Deleted":false,"Data":{"type":"REG_DWORD","value":` +
+			fmt.Sprintf("%d", start) + `}}`
+	}
+
+	// CurrentControlSet is the control set selected by Select\Current
+	assert.Equal(t, []string{
+		row("CurrentControlSet", "null", 3),
+		row("ControlSet001", `"LastKnownGood"`, 2),
+		row("ControlSet002", `"Current"`, 3),
+		row("ControlSet003", `"Orphaned"`, 4),
+	}, runRules(t, registry, []config.RegistryRule{{
+		Id:          "services",
+		Description: "Services",
+		Category:    "Services",
+		Root:        "HKEY_LOCAL_MACHINE\\System",
+		Globs: []string{"CurrentControlSet\\Services\\*\\Start",
+			"ControlSet00*\\Services\\*\\Start"},
+	}}))
+}
+
+func TestRuleTests(t *testing.T) {
+	rule := config.RegistryRule{
+		Description: "Run",
+		Root:        "HKEY_LOCAL_MACHINE\\Software",
+		Globs:       []string{"Microsoft\\Run\\*", "Microsoft\\RunOnce\\*"},
+	}
+
+	hives := []config.TestHive{{
+		Keys: []config.TestKey{{
+			Name: "Microsoft",
+			Keys: []config.TestKey{{
+				Name:   "Run",
+				Values: []config.TestValue{{Name: "A", Data: "a.exe"}},
+			}, {
+				Name:   "RunOnce",
+				Values: []config.TestValue{{Name: "B", Type: "REG_DWORD", Data: 1}},
+			}},
+		}},
+	}}
+
+	results := RunTests(rule, []config.RuleTest{{
+		Name:  "Passing",
+		Hives: hives,
+		Expected: []config.ExpectedRow{{
+			OSPath: "HKEY_LOCAL_MACHINE\\Software\\Microsoft\\Run\\A",
+			Value:  "a.exe",
+		}, {
+			OSPath: "HKEY_LOCAL_MACHINE\\Software\\Microsoft\\RunOnce\\B",
+			Type:   "REG_DWORD",
+			Value:  1,
+		}},
+	}, {
+		Name:  "Failing",
+		Hives: hives,
+		Expected: []config.ExpectedRow{{
+			OSPath: "HKEY_LOCAL_MACHINE\\Software\\Microsoft\\Run\\A",
+			Value:  "b.exe",
+		}},
+	}}, ".")
+
+	require.Equal(t, 2, len(results))
+	assert.True(t, results[0].Passed(), results[0].Errors)
+	assert.Equal(t, []string{
+		`Row HKEY_LOCAL_MACHINE\Software\Microsoft\Run\A: expected value "b.exe" but got "a.exe"`,
+		`Unexpected row HKEY_LOCAL_MACHINE\Software\Microsoft\RunOnce\B`,
+	}, results[1].Errors)
+}
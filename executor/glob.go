@@ -0,0 +1,238 @@
+package executor
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Same as the default depth of ** in Velociraptor's glob()
+	default_recursion_depth = 30
+)
+
+var (
+	KeyNotFoundError = errors.New("Key not found")
+
+	recursiveRegex = regexp.MustCompile(`^\*\*(\d*)$`)
+)
+
+// Split a registry path into components. Components containing path
+// separators may be quoted with double quotes.
+func SplitPath(path string) []string {
+	var result []string
+	var current strings.Builder
+	in_quote := false
+
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case in_quote && c == '\\' && i+1 < len(path) && path[i+1] == '"':
+			current.WriteByte('"')
+			i++
+
+		case c == '"':
+			in_quote = !in_quote
+
+		case !in_quote && (c == '\\' || c == '/'):
+			if current.Len() > 0 {
+				result = append(result, current.String())
+				current.Reset()
+			}
+
+		default:
+			current.WriteByte(c)
+		}
+	}
+
+	if current.Len() > 0 {
+		result = append(result, current.String())
+	}
+	return result
+}
+
+// Join the components into a registry path, quoting components that
+// contain path separators.
+func JoinPath(components []string) string {
+	result := make([]string, 0, len(components))
+	for _, c := range components {
+		if strings.ContainsAny(c, "\\/") {
+			c = "\"" + strings.Replace(c, "\"", "\\\"", -1) + "\""
+		}
+		result = append(result, c)
+	}
+	return strings.Join(result, "\\")
+}
+
+type globComponent struct {
+	literal   string
+	regex     *regexp.Regexp
+	recursive bool
+	depth     int
+}
+
+func (self *globComponent) match(name string) bool {
+	if self.regex != nil {
+		return self.regex.MatchString(name)
+	}
+	return strings.EqualFold(self.literal, name)
+}
+
+// Convert a glob expression to a list of component matchers. Brace
+// expansion is handled by the compiler so it is not supported here.
+func compileGlob(glob string) ([]*globComponent, error) {
+	var result []*globComponent
+
+	for _, component := range SplitPath(glob) {
+		m := recursiveRegex.FindStringSubmatch(component)
+		if len(m) > 0 {
+			depth := default_recursion_depth
+			if m[1] != "" {
+				depth, _ = strconv.Atoi(m[1])
+			}
+			result = append(result, &globComponent{
+				recursive: true, depth: depth})
+			continue
+		}
+
+		if !strings.ContainsAny(component, "*?[") {
+			result = append(result, &globComponent{literal: component})
+			continue
+		}
+
+		regex, err := regexp.Compile(
+			"(?is)^" + globToRegex(component) + "$")
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &globComponent{regex: regex})
+	}
+	return result, nil
+}
+
+func globToRegex(component string) string {
+	var result strings.Builder
+	for i := 0; i < len(component); i++ {
+		c := component[i]
+		switch c {
+		case '*':
+			result.WriteString(".*")
+		case '?':
+			result.WriteString(".")
+		case '[':
+			end := strings.IndexByte(component[i+1:], ']')
+			if end < 0 {
+				result.WriteString(regexp.QuoteMeta(component[i:]))
+				return result.String()
+			}
+			class := component[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			result.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			result.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return result.String()
+}
+
+// Glob the registry under the root path, calling cb for every key
+// or value matching any of the globs.
+func (self *Registry) Glob(root string, globs []string, cb func(e *Entry)) error {
+	var compiled [][]*globComponent
+	for _, glob := range globs {
+		components, err := compileGlob(glob)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, components)
+	}
+
+	root_components := SplitPath(root)
+	dir := self.openDirectory(root_components)
+	if dir == nil {
+		return nil
+	}
+
+	// A key and a value may have the same name so both are emitted.
+	seen := make(map[string]bool)
+	emit := func(e *Entry) {
+		key := e.OSPath()
+		if e.IsDir {
+			key += "\\"
+		}
+		if !seen[key] {
+			seen[key] = true
+			cb(e)
+		}
+	}
+
+	for _, components := range compiled {
+		globDirectory(dir, root_components, components, emit)
+	}
+	return nil
+}
+
+func globDirectory(dir *directory, path []string,
+	components []*globComponent, cb func(e *Entry)) {
+	if len(components) == 0 {
+		return
+	}
+
+	current := components[0]
+	rest := components[1:]
+
+	if current.recursive {
+		globRecursive(dir, path, rest, current.depth, cb)
+		return
+	}
+
+	// Avoid listing large keys when the component is a literal.
+	if current.regex == nil {
+		for _, e := range dir.lookup(path, current.literal) {
+			globMatch(e, rest, cb)
+		}
+		return
+	}
+
+	for _, e := range dir.list(path) {
+		if current.match(e.Name()) {
+			globMatch(e, rest, cb)
+		}
+	}
+}
+
+func globMatch(e *Entry, rest []*globComponent, cb func(e *Entry)) {
+	if len(rest) == 0 {
+		cb(e)
+		return
+	}
+
+	if e.IsDir && e.dir != nil {
+		globDirectory(e.dir, e.Components, rest, cb)
+	}
+}
+
+// A recursive component matches zero or more levels of keys.
+func globRecursive(dir *directory, path []string,
+	rest []*globComponent, depth int, cb func(e *Entry)) {
+	if depth < 0 {
+		return
+	}
+
+	globDirectory(dir, path, rest, cb)
+
+	for _, e := range dir.list(path) {
+		// A trailing ** matches everything below.
+		if len(rest) == 0 {
+			cb(e)
+		}
+
+		if e.IsDir && e.dir != nil {
+			globRecursive(e.dir, e.Components, rest, depth-1, cb)
+		}
+	}
+}
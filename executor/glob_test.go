@@ -0,0 +1,35 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitPath(t *testing.T) {
+	assert.Equal(t, []string{"HKEY_USERS", "user1", "Software"},
+		SplitPath(`HKEY_USERS\user1/Software\`))
+
+	// Quoted components may contain path separators.
+	assert.Equal(t, []string{"Run", `C:\Windows\"notepad".exe`},
+		SplitPath(`Run\"C:\Windows\\"notepad\".exe"`))
+
+	assert.Equal(t, `Run\"C:\Windows"`, JoinPath([]string{"Run", `C:\Windows`}))
+}
+
+func TestGlobComponents(t *testing.T) {
+	components, err := compileGlob(`ControlSet00*\Services\**5\ImagePath`)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(components))
+
+	assert.True(t, components[0].match("controlset001"))
+	assert.False(t, components[0].match("CurrentControlSet"))
+	assert.True(t, components[1].match("SERVICES"))
+	assert.True(t, components[2].recursive)
+	assert.Equal(t, 5, components[2].depth)
+
+	components, err = compileGlob(`Test[0-9]?.txt`)
+	assert.NoError(t, err)
+	assert.True(t, components[0].match("test1a.txt"))
+	assert.False(t, components[0].match("testa1.txt"))
+}
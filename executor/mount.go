@@ -0,0 +1,298 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Velocidex/registry_hunter/config"
+	"github.com/Velocidex/registry_hunter/regf"
+)
+
+// How the transaction logs (.LOG1/.LOG2) of the hives are used.
+const (
+	// Only the primary hive files.
+	TRANSACTION_LOGS_PRIMARY = "Primary"
+
+	// The hives with the changes recovered from the logs.
+	TRANSACTION_LOGS_REPLAYED = "Replayed"
+
+	// The primary hives and the keys and values recovered from the
+	// logs.
+	TRANSACTION_LOGS_BOTH = "Both"
+)
+
+// Locations of the hive files. These correspond to the PathTO*
+// parameters of the artifact.
+type HivePaths struct {
+	Mounts *config.Mounts
+
+	// Hive files by their parameter (e.g. PathTOSystem)
+	Paths map[string]string
+
+	// The directory containing the user profiles.
+	Users string
+
+	// Mount user hives under their SID, profile folder name or both
+	// (see config.USER_KEY_USERNAME)
+	UserHiveKey string
+
+	// One of the TRANSACTION_LOGS_* modes.
+	TransactionLogs string
+
+	// Also report the deleted keys and values carved from the hives.
+	RecoverDeleted bool
+}
+
+func DefaultHivePaths(root_drive string) *HivePaths {
+	mounts := config.DefaultMounts()
+	result := &HivePaths{
+		Mounts: mounts,
+		Paths:  make(map[string]string),
+		Users:  filepath.Join(root_drive, mounts.UsersPath),
+
+		UserHiveKey:     config.USER_KEY_USERNAME,
+		TransactionLogs: TRANSACTION_LOGS_PRIMARY,
+	}
+
+	for _, hive := range mounts.Hives {
+		if hive.Path != "" && !hive.PerUser {
+			result.Paths[hive.Parameter] = filepath.Join(root_drive, hive.Path)
+		}
+	}
+	return result
+}
+
+// Record of each mount operation, similar to the Remapping source of
+// the artifact.
+type MountInfo struct {
+	Description  string
+	HivePath     string
+	RegistryPath string
+
+	// Some of the hive was recovered from its transaction logs.
+	Replayed bool   `json:",omitempty"`
+	Error    string `json:",omitempty"`
+}
+
+// Mount the hives in the same layout as the "Raw Hives" remapping
+// strategy of the artifact template.
+func (self *Registry) MountHives(paths *HivePaths) []MountInfo {
+	self.recover_deleted = paths.RecoverDeleted
+
+	switch paths.TransactionLogs {
+	case TRANSACTION_LOGS_REPLAYED:
+		self.replay = true
+
+	case TRANSACTION_LOGS_BOTH:
+		// The replayed hives are mounted in a second registry which
+		// only contributes the rows recovered from the logs. Both
+		// sets of mounts are reported, the primary ones first.
+		self.replayed = NewRegistry()
+		self.replayed.replay = true
+		self.replayed.recover_deleted = paths.RecoverDeleted
+		return append(self.mountHives(paths),
+			self.replayed.mountHives(paths)...)
+	}
+
+	return self.mountHives(paths)
+}
+
+func (self *Registry) mountHives(paths *HivePaths) []MountInfo {
+	var result []MountInfo
+
+	mount := func(hive_path, registry_path, key_path, description string) {
+		info := MountInfo{
+			Description:  description,
+			HivePath:     hive_path,
+			RegistryPath: registry_path,
+		}
+
+		hive, err := self.mountFile(hive_path, registry_path, key_path)
+		if err != nil {
+			info.Error = err.Error()
+		} else {
+			info.Replayed = hive.Replayed()
+		}
+		result = append(result, info)
+	}
+
+	self.loadProfiles(paths)
+	self.loadControlSets(paths)
+	users_dir, users_err := findFileNoCase(paths.Users)
+
+	for _, hive := range paths.Mounts.Hives {
+		for _, m := range hive.Mounts {
+			// We only have the registry accessor.
+			if !m.Uses(config.RAW_HIVES_STRATEGY) ||
+				m.Accessor != config.DEFAULT_MOUNT_ACCESSOR {
+				continue
+			}
+
+			if !hive.PerUser {
+				key_path := m.KeyPath
+				if m.ControlSet != "" {
+					key_path = "/" + self.control_sets.name(m.ControlSet)
+				}
+
+				mount(paths.Paths[hive.Parameter], m.RegistryPath, key_path,
+					m.Description)
+				continue
+			}
+
+			// User hives are globbed below the users directory so
+			// only mount the ones we find.
+			if users_err != nil {
+				continue
+			}
+
+			findUserHives(users_dir, strings.Split(hive.Path, "/"), nil,
+				func(hive_path string, values map[string]string) {
+					username := values[config.USER_PLACEHOLDER]
+					for _, key := range self.profiles.keys(
+						username, paths.UserHiveKey) {
+						values[config.USER_PLACEHOLDER] = key
+						mount(hive_path, config.Expand(m.RegistryPath, values),
+							m.KeyPath, config.Expand(m.Description, values))
+					}
+				})
+		}
+	}
+
+	return result
+}
+
+// Find the hives matching the path components below dir. Placeholder
+// components match any file and record its name.
+func findUserHives(dir string, components []string, values map[string]string,
+	cb func(hive_path string, values map[string]string)) {
+	if len(components) == 0 {
+		cb(dir, values)
+		return
+	}
+
+	component := components[0]
+	if !config.PlaceholderRegex.MatchString(component) {
+		path, err := findFileNoCase(filepath.Join(dir, component))
+		if err == nil {
+			findUserHives(path, components[1:], values, cb)
+		}
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		matched := map[string]string{component: e.Name()}
+		for k, v := range values {
+			matched[k] = v
+		}
+		findUserHives(filepath.Join(dir, e.Name()), components[1:], matched, cb)
+	}
+}
+
+func (self *Registry) mountFile(
+	hive_path, registry_path, key_path string) (*regf.Hive, error) {
+	path, err := findFileNoCase(hive_path)
+	if err != nil {
+		return nil, err
+	}
+
+	hive, err := self.openHive(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return hive, self.Mount(registry_path, hive, key_path)
+}
+
+// The same hive is often mounted in multiple places so we cache it.
+func (self *Registry) openHive(path string) (*regf.Hive, error) {
+	hive, pres := self.hives[path]
+	if pres {
+		return hive, nil
+	}
+
+	hive, err := regf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.replay {
+		hive, err = hive.Replay(ReadTransactionLogs(path)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if self.recover_deleted {
+		hive.RecoverDeleted()
+	}
+
+	self.hives[path] = hive
+	return hive, nil
+}
+
+// Read the transaction logs next to the hive file.
+func ReadTransactionLogs(path string) [][]byte {
+	var result [][]byte
+	for _, extension := range []string{".LOG1", ".LOG2", ".LOG"} {
+		log_path, err := findFileNoCase(path + extension)
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(log_path)
+		if err == nil {
+			result = append(result, data)
+		}
+	}
+	return result
+}
+
+// Hives are often collected from Windows systems onto case sensitive
+// filesystems so we need to find them case insensitively.
+func findFileNoCase(path string) (string, error) {
+	_, err := os.Lstat(path)
+	if err == nil {
+		return path, nil
+	}
+
+	path = filepath.Clean(path)
+	current := filepath.VolumeName(path)
+	rest := path[len(current):]
+	if strings.HasPrefix(rest, string(filepath.Separator)) {
+		current += string(filepath.Separator)
+	} else {
+		current = "."
+	}
+
+	for _, component := range strings.Split(rest, string(filepath.Separator)) {
+		if component == "" {
+			continue
+		}
+
+		entries, err := os.ReadDir(current)
+		if err != nil {
+			return "", err
+		}
+
+		found := ""
+		for _, e := range entries {
+			if strings.EqualFold(e.Name(), component) {
+				found = e.Name()
+				break
+			}
+		}
+
+		if found == "" {
+			return "", os.ErrNotExist
+		}
+		current = filepath.Join(current, found)
+	}
+
+	return current, nil
+}
@@ -0,0 +1,361 @@
+package executor
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/Velocidex/registry_hunter/regf"
+)
+
+// A Registry is a virtual registry hierarchy built by mounting raw
+// hives at various points. This mirrors the remapping configuration
+// that the artifact template builds inside Velociraptor.
+type Registry struct {
+	root     *mountNode
+	hives    map[string]*regf.Hive
+	profiles *userProfiles
+
+	control_sets *controlSets
+
+	// Replay the transaction logs of the hives.
+	replay bool
+
+	// Carve the deleted keys and values of the hives.
+	recover_deleted bool
+
+	// The registry with the replayed hives when both the primary and
+	// replayed hives are used.
+	replayed *Registry
+}
+
+// A node in the mount tree. Intermediate nodes have no key and just
+// serve to hold their children.
+type mountNode struct {
+	name     string
+	key      *regf.Key
+	children map[string]*mountNode
+
+	// Keep the children in mount order so listings are stable.
+	order []string
+}
+
+func newMountNode(name string) *mountNode {
+	return &mountNode{
+		name:     name,
+		children: make(map[string]*mountNode),
+	}
+}
+
+func (self *mountNode) child(name string) *mountNode {
+	return self.children[strings.ToLower(name)]
+}
+
+func (self *mountNode) addChild(name string) *mountNode {
+	lower := strings.ToLower(name)
+	child, pres := self.children[lower]
+	if !pres {
+		child = newMountNode(name)
+		self.children[lower] = child
+		self.order = append(self.order, lower)
+	}
+	return child
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		root:     newMountNode(""),
+		hives:    make(map[string]*regf.Hive),
+		profiles: newUserProfiles(),
+
+		control_sets: newControlSets(),
+	}
+}
+
+// Mount the key at key_path inside the hive on the registry path. For
+// example mounting the SYSTEM hive's /ControlSet002 key at
+// HKEY_LOCAL_MACHINE\System\CurrentControlSet.
+func (self *Registry) Mount(
+	registry_path string, hive *regf.Hive, key_path string) error {
+	root, err := hive.Root()
+	if err != nil {
+		return err
+	}
+
+	key := root.OpenPath(key_path)
+	if key == nil {
+		return KeyNotFoundError
+	}
+
+	node := self.root
+	for _, component := range SplitPath(registry_path) {
+		node = node.addChild(component)
+	}
+	node.key = key
+	return nil
+}
+
+// An Entry is either a key or a value in the virtual registry. Keys
+// are directories and values are files, just like the Velociraptor
+// registry accessor.
+type Entry struct {
+	Components []string
+	IsDir      bool
+	Mtime      time.Time
+
+	// The key or value was recovered from the transaction logs.
+	Replayed bool
+
+	// The key or value was carved from the unallocated cells.
+	Deleted bool
+
+	// Set for values
+	Type  string
+	Value interface{}
+
+	dir *directory
+}
+
+func (self *Entry) Name() string {
+	if len(self.Components) == 0 {
+		return ""
+	}
+	return self.Components[len(self.Components)-1]
+}
+
+func (self *Entry) OSPath() string {
+	return JoinPath(self.Components)
+}
+
+// The Data column as presented by the registry accessor.
+func (self *Entry) Data() *ordereddict.Dict {
+	if self.IsDir {
+		return ordereddict.NewDict().Set("type", "Key")
+	}
+	return ordereddict.NewDict().
+		Set("type", self.Type).
+		Set("value", self.Value)
+}
+
+// A directory merges the keys from a hive with any mount points
+// overlaid on it.
+type directory struct {
+	node *mountNode
+	key  *regf.Key
+}
+
+func (self *directory) mtime() time.Time {
+	if self.key != nil {
+		return self.key.LastWriteTime()
+	}
+	return time.Time{}
+}
+
+func (self *directory) replayed() bool {
+	return self.key != nil && self.key.Replayed()
+}
+
+func (self *directory) deleted() bool {
+	return self.key != nil && self.key.Deleted()
+}
+
+// The subkeys of the key followed by the deleted subkeys which were
+// not replaced by a key of the same name.
+func subkeys(key *regf.Key) []*regf.Key {
+	var result []*regf.Key
+	seen := make(map[string]bool)
+
+	// The subkey list of a deleted key is no longer valid.
+	if !key.Deleted() {
+		for _, subkey := range key.Subkeys() {
+			seen[strings.ToLower(subkey.Name())] = true
+			result = append(result, subkey)
+		}
+	}
+
+	for _, subkey := range key.DeletedSubkeys() {
+		name := strings.ToLower(subkey.Name())
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, subkey)
+		}
+	}
+	return result
+}
+
+// The values of the key followed by the deleted values which were not
+// replaced by a value of the same name.
+func values(key *regf.Key) []*regf.Value {
+	result := key.Values()
+	seen := make(map[string]bool)
+	for _, value := range result {
+		seen[strings.ToLower(value.Name())] = true
+	}
+
+	for _, value := range key.DeletedValues() {
+		name := strings.ToLower(value.Name())
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func findSubkey(key *regf.Key, name string) *regf.Key {
+	for _, subkey := range subkeys(key) {
+		if strings.EqualFold(subkey.Name(), name) {
+			return subkey
+		}
+	}
+	return nil
+}
+
+func findValue(key *regf.Key, name string) *regf.Value {
+	for _, value := range values(key) {
+		if strings.EqualFold(value.Name(), name) {
+			return value
+		}
+	}
+	return nil
+}
+
+// Descend into the named subdirectory.
+func (self *directory) open(name string) *directory {
+	result := &directory{}
+	if self.node != nil {
+		result.node = self.node.child(name)
+		if result.node != nil && result.node.key != nil {
+			result.key = result.node.key
+			return result
+		}
+	}
+
+	if self.key != nil {
+		result.key = findSubkey(self.key, name)
+	}
+
+	if result.node == nil && result.key == nil {
+		return nil
+	}
+	return result
+}
+
+// List all the keys and values in the directory.
+func (self *directory) list(components []string) []*Entry {
+	var result []*Entry
+	seen := make(map[string]bool)
+
+	child_path := func(name string) []string {
+		return append(append([]string{}, components...), name)
+	}
+
+	// Mount points hide keys of the same name in the hive.
+	if self.node != nil {
+		for _, lower := range self.node.order {
+			child := self.node.children[lower]
+			seen[lower] = true
+			dir := self.open(child.name)
+			result = append(result, &Entry{
+				Components: child_path(child.name),
+				IsDir:      true,
+				Mtime:      dir.mtime(),
+				Replayed:   dir.replayed(),
+				Deleted:    dir.deleted(),
+				dir:        dir,
+			})
+		}
+	}
+
+	if self.key == nil {
+		return result
+	}
+
+	for _, key := range subkeys(self.key) {
+		name := key.Name()
+		if seen[strings.ToLower(name)] {
+			continue
+		}
+		result = append(result, &Entry{
+			Components: child_path(name),
+			IsDir:      true,
+			Mtime:      key.LastWriteTime(),
+			Replayed:   key.Replayed(),
+			Deleted:    key.Deleted(),
+			dir:        &directory{key: key},
+		})
+	}
+
+	mtime := self.key.LastWriteTime()
+	for _, value := range values(self.key) {
+		name := value.Name()
+
+		// The default value is presented as @
+		if name == "" {
+			name = "@"
+		}
+		result = append(result, &Entry{
+			Components: child_path(name),
+			Mtime:      mtime,
+			Replayed:   value.Replayed(),
+			Deleted:    value.Deleted(),
+			Type:       value.TypeName(),
+			Value:      value.Decode(),
+		})
+	}
+
+	return result
+}
+
+// Find the key and value with the specified name without listing the
+// entire directory.
+func (self *directory) lookup(components []string, name string) []*Entry {
+	var result []*Entry
+	child_path := append(append([]string{}, components...), name)
+
+	dir := self.open(name)
+	if dir != nil {
+		result = append(result, &Entry{
+			Components: child_path,
+			IsDir:      true,
+			Mtime:      dir.mtime(),
+			Replayed:   dir.replayed(),
+			Deleted:    dir.deleted(),
+			dir:        dir,
+		})
+	}
+
+	if self.key == nil {
+		return result
+	}
+
+	value_name := name
+	if value_name == "@" {
+		value_name = ""
+	}
+
+	value := findValue(self.key, value_name)
+	if value != nil {
+		result = append(result, &Entry{
+			Components: child_path,
+			Mtime:      self.key.LastWriteTime(),
+			Replayed:   value.Replayed(),
+			Deleted:    value.Deleted(),
+			Type:       value.TypeName(),
+			Value:      value.Decode(),
+		})
+	}
+
+	return result
+}
+
+func (self *Registry) openDirectory(components []string) *directory {
+	dir := &directory{node: self.root}
+	for _, component := range components {
+		dir = dir.open(component)
+		if dir == nil {
+			return nil
+		}
+	}
+	return dir
+}
@@ -0,0 +1,241 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/Velocidex/registry_hunter/config"
+	"github.com/Velocidex/registry_hunter/regf"
+)
+
+type TestResult struct {
+	Description string
+	Name        string
+
+	// Set when the rule can not be tested natively.
+	Skipped string
+
+	Errors []string
+}
+
+func (self *TestResult) Passed() bool {
+	return self.Skipped == "" && len(self.Errors) == 0
+}
+
+func (self *TestResult) fail(format string, args ...interface{}) {
+	self.Errors = append(self.Errors, fmt.Sprintf(format, args...))
+}
+
+// Run the embedded tests of a rule. The base_dir is the directory of
+// the rule file, used to resolve hive paths.
+func RunTests(rule config.RegistryRule,
+	tests []config.RuleTest, base_dir string) []*TestResult {
+	var result []*TestResult
+
+	for i, test := range tests {
+		name := test.Name
+		if name == "" {
+			name = fmt.Sprintf("Test %d", i)
+		}
+
+		test_result := &TestResult{
+			Description: rule.Description,
+			Name:        name,
+		}
+		result = append(result, test_result)
+
+		err := Supported(&rule)
+		if err != nil {
+			test_result.Skipped = err.Error()
+			continue
+		}
+
+		registry := NewRegistry()
+		for _, h := range test.Hives {
+			err := mountTestHive(registry, &rule, &h, base_dir)
+			if err != nil {
+				test_result.fail("Mounting hive: %v", err)
+			}
+		}
+
+		rows := []*ordereddict.Dict{}
+		executor := NewExecutor(registry)
+		executor.Run([]config.RegistryRule{rule}, func(row *ordereddict.Dict) {
+			rows = append(rows, row)
+		})
+
+		for _, e := range executor.Errors() {
+			test_result.fail("%v", e.Error)
+		}
+
+		compareRows(test_result, test.Expected, rows)
+	}
+
+	return result
+}
+
+func mountTestHive(registry *Registry, rule *config.RegistryRule,
+	spec *config.TestHive, base_dir string) error {
+	mount_point := spec.Mount
+	if mount_point == "" {
+		mount_point = rule.Root
+	}
+
+	var hive *regf.Hive
+	var err error
+
+	switch {
+	case spec.Path != "" && strings.HasSuffix(spec.Path, ".yaml"):
+		var hive_spec *regf.HiveSpec
+		hive_spec, err = regf.LoadHiveSpecFile(filepath.Join(base_dir, spec.Path))
+		if err == nil {
+			hive, err = buildHive(hive_spec)
+		}
+
+	case spec.Path != "":
+		hive, err = regf.Open(filepath.Join(base_dir, spec.Path))
+
+	default:
+		hive, err = buildHive(&regf.HiveSpec{
+			Root: regf.KeySpec{
+				Keys:   testKeySpecs(spec.Keys),
+				Values: testValueSpecs(spec.Values),
+			},
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	return registry.Mount(mount_point, hive, "/")
+}
+
+func testKeySpecs(keys []config.TestKey) []regf.KeySpec {
+	var result []regf.KeySpec
+	for _, key := range keys {
+		result = append(result, regf.KeySpec{
+			Name:          key.Name,
+			LastWriteTime: key.LastWriteTime,
+			ClassName:     key.ClassName,
+			Values:        testValueSpecs(key.Values),
+			Keys:          testKeySpecs(key.Keys),
+			Deleted:       key.Deleted,
+		})
+	}
+	return result
+}
+
+func testValueSpecs(values []config.TestValue) []regf.ValueSpec {
+	var result []regf.ValueSpec
+	for _, value := range values {
+		result = append(result, regf.ValueSpec{
+			Name:    value.Name,
+			Type:    value.Type,
+			Data:    value.Data,
+			Hex:     value.Hex,
+			Deleted: value.Deleted,
+		})
+	}
+	return result
+}
+
+func buildHive(spec *regf.HiveSpec) (*regf.Hive, error) {
+	data, err := regf.BuildHive(spec)
+	if err != nil {
+		return nil, err
+	}
+	return regf.NewHive(data)
+}
+
+// Every expected row must match exactly one produced row and there
+// must be no extra rows.
+func compareRows(result *TestResult,
+	expected []config.ExpectedRow, rows []*ordereddict.Dict) {
+	actual := make(map[string]*ordereddict.Dict)
+	for _, row := range rows {
+		os_path, _ := row.GetString("OSPath")
+		data, _ := row.Get("Data")
+		data_dict, _ := data.(*ordereddict.Dict)
+		value_type, _ := data_dict.GetString("type")
+
+		// Keys and values may have the same path.
+		actual[strings.ToLower(os_path)+"\x00"+value_type] = row
+	}
+
+	for _, e := range expected {
+		row, pres := findRow(actual, e)
+		if !pres {
+			result.fail("Expected row %v was not produced", e.OSPath)
+			continue
+		}
+
+		data, _ := row.Get("Data")
+		data_dict, _ := data.(*ordereddict.Dict)
+		if e.Value != nil {
+			value, _ := data_dict.Get("value")
+			if !jsonEqual(value, e.Value) {
+				result.fail("Row %v: expected value %v but got %v",
+					e.OSPath, asJson(e.Value), asJson(value))
+			}
+		}
+	}
+
+	extra := []string{}
+	for _, row := range actual {
+		os_path, _ := row.GetString("OSPath")
+		extra = append(extra, os_path)
+	}
+	sort.Strings(extra)
+
+	for _, os_path := range extra {
+		result.fail("Unexpected row %v", os_path)
+	}
+}
+
+// Finds the row matching the expected row and removes it from the
+// remaining rows.
+func findRow(actual map[string]*ordereddict.Dict,
+	e config.ExpectedRow) (*ordereddict.Dict, bool) {
+	prefix := strings.ToLower(e.OSPath) + "\x00"
+
+	// Keys sort before values with the same path.
+	keys := make([]string, 0, len(actual))
+	for k := range actual {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		row := actual[k]
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		if e.Type != "" && !strings.EqualFold(k[len(prefix):], e.Type) {
+			continue
+		}
+
+		delete(actual, k)
+		return row, true
+	}
+	return nil, false
+}
+
+// Compare values after normalizing them through JSON so that YAML
+// integers and lists compare equal to the decoded registry values.
+func jsonEqual(a, b interface{}) bool {
+	var a_norm, b_norm interface{}
+	json.Unmarshal([]byte(asJson(a)), &a_norm)
+	json.Unmarshal([]byte(asJson(b)), &b_norm)
+	return reflect.DeepEqual(a_norm, b_norm)
+}
+
+func asJson(item interface{}) string {
+	serialized, _ := json.Marshal(item)
+	return string(serialized)
+}
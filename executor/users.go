@@ -0,0 +1,130 @@
+package executor
+
+import (
+	"strings"
+
+	"github.com/Velocidex/registry_hunter/config"
+)
+
+// The DEFAULT hive mounted under HKEY_USERS\.DEFAULT is the profile
+// of the LocalSystem account.
+const (
+	DEFAULT_USER_KEY      = ".DEFAULT"
+	LOCAL_SYSTEM_SID      = "S-1-5-18"
+	LOCAL_SYSTEM_USERNAME = "SYSTEM"
+)
+
+// The users found in the ProfileList so user hives can be mounted
+// under their SID, similar to _ProfileList in the artifact template.
+type userProfiles struct {
+	// SIDs by lower case profile folder name
+	sids map[string]string
+
+	// Profile folder names by SID
+	usernames map[string]string
+
+	// The roots of the user hives (e.g. HKEY_USERS)
+	roots [][]string
+}
+
+func newUserProfiles() *userProfiles {
+	return &userProfiles{
+		sids:      make(map[string]string),
+		usernames: make(map[string]string),
+	}
+}
+
+// Read the ProfileList from the raw hive.
+func (self *Registry) loadProfiles(paths *HivePaths) {
+	for _, root := range paths.Mounts.UserRoots() {
+		self.profiles.roots = append(self.profiles.roots, SplitPath(root))
+	}
+
+	hive_info, err := paths.Mounts.Hive(paths.Mounts.ProfileList.Hive)
+	if err != nil {
+		return
+	}
+
+	path, err := findFileNoCase(paths.Paths[hive_info.Parameter])
+	if err != nil {
+		return
+	}
+
+	hive, err := self.openHive(path)
+	if err != nil {
+		return
+	}
+
+	root, err := hive.Root()
+	if err != nil {
+		return
+	}
+
+	profile_list := root.OpenPath(paths.Mounts.ProfileList.Key)
+	if profile_list == nil {
+		return
+	}
+
+	for _, profile := range profile_list.Subkeys() {
+		value := profile.Value("ProfileImagePath")
+		if value == nil {
+			continue
+		}
+
+		image_path, ok := value.Decode().(string)
+		if !ok {
+			continue
+		}
+
+		components := strings.Split(strings.TrimRight(image_path, "\\"), "\\")
+		username := components[len(components)-1]
+		sid := profile.Name()
+
+		self.profiles.sids[strings.ToLower(username)] = sid
+		self.profiles.usernames[sid] = username
+	}
+}
+
+// The keys a user hive is mounted under, depending on the UserHiveKey
+// option. Users missing from the ProfileList are always mounted under
+// their profile folder name.
+func (self *userProfiles) keys(username, user_hive_key string) []string {
+	sid, pres := self.sids[strings.ToLower(username)]
+	if !pres || strings.EqualFold(user_hive_key, config.USER_KEY_USERNAME) {
+		return []string{username}
+	}
+
+	if strings.EqualFold(user_hive_key, config.USER_KEY_BOTH) {
+		return []string{username, sid}
+	}
+	return []string{sid}
+}
+
+// Identify the user owning the key from the key below the user hive
+// root. Returns nil for keys outside the user hives.
+func (self *userProfiles) identify(components []string) (sid, username interface{}) {
+	for _, root := range self.roots {
+		if len(components) <= len(root) ||
+			!strings.EqualFold(JoinPath(components[:len(root)]), JoinPath(root)) {
+			continue
+		}
+
+		// In API mode the classes hive is mounted as <SID>_Classes
+		key := strings.TrimSuffix(components[len(root)], "_Classes")
+		if strings.EqualFold(key, DEFAULT_USER_KEY) {
+			return LOCAL_SYSTEM_SID, LOCAL_SYSTEM_USERNAME
+		}
+		if strings.HasPrefix(strings.ToUpper(key), "S-1-") {
+			return key, nilIfEmpty(self.usernames[key])
+		}
+		return nilIfEmpty(self.sids[strings.ToLower(key)]), key
+	}
+	return nil, nil
+}
+
+func nilIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
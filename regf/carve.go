@@ -0,0 +1,123 @@
+package regf
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Describe the deleted keys and values of the hive (see
+// RecoverDeleted) as a hive of their own. The deleted records are kept
+// at their original path below copies of their allocated parent keys
+// so the carved hive can be mounted in place of the hive. Returns
+// false if nothing was carved.
+func (self *Hive) CarveDeleted() (*HiveSpec, bool) {
+	self.RecoverDeleted()
+
+	root, err := self.Root()
+	if err != nil {
+		return nil, false
+	}
+
+	carver := &carver{seen: make(map[uint32]bool)}
+	spec, found := carver.carveKey(root)
+	if !found {
+		return nil, false
+	}
+
+	return &HiveSpec{
+		FileName:    self.FileName,
+		LastWritten: formatTime(self.LastWritten),
+		Root:        spec,
+	}, true
+}
+
+type carver struct {
+	// Deleted keys may still point at each other as their parent.
+	seen map[uint32]bool
+}
+
+// Copy the key with its deleted subkeys and values, and its allocated
+// subkeys which have deleted records below them. Deleted keys are
+// copied entirely. Returns true if anything deleted was found.
+func (self *carver) carveKey(key *Key) (KeySpec, bool) {
+	self.seen[key.offset] = true
+
+	deleted := key.Deleted()
+	spec := KeySpec{
+		Name:               key.Name(),
+		LastWriteTime:      formatTime(key.LastWriteTime()),
+		ClassName:          key.ClassName(),
+		SecurityDescriptor: hex.EncodeToString(key.SecurityDescriptor()),
+	}
+	found := deleted
+
+	// Only the deleted values of an allocated key which were not
+	// replaced by a value of the same name.
+	names := make(map[string]bool)
+	for _, value := range key.Values() {
+		names[strings.ToLower(value.Name())] = true
+		if deleted {
+			spec.addValue(value)
+		}
+	}
+
+	for _, value := range key.DeletedValues() {
+		name := strings.ToLower(value.Name())
+		if !names[name] {
+			names[name] = true
+			spec.addValue(value)
+			found = true
+		}
+	}
+
+	// The subkey list of a deleted key is no longer valid.
+	names = make(map[string]bool)
+	if !deleted {
+		for _, subkey := range key.Subkeys() {
+			names[strings.ToLower(subkey.Name())] = true
+			if self.seen[subkey.offset] {
+				continue
+			}
+
+			subkey_spec, subkey_found := self.carveKey(subkey)
+			if subkey_found {
+				spec.Keys = append(spec.Keys, subkey_spec)
+				found = true
+			}
+		}
+	}
+
+	for _, subkey := range key.DeletedSubkeys() {
+		name := strings.ToLower(subkey.Name())
+		if names[name] || self.seen[subkey.offset] {
+			continue
+		}
+		names[name] = true
+
+		subkey_spec, _ := self.carveKey(subkey)
+		spec.Keys = append(spec.Keys, subkey_spec)
+		found = true
+	}
+
+	return spec, found
+}
+
+// Copy the value with its raw data. Values of an unknown type can
+// not be written back.
+func (self *KeySpec) addValue(value *Value) {
+	type_name := value.TypeName()
+	if _, err := typeFromName(type_name); err != nil {
+		return
+	}
+
+	self.Values = append(self.Values, ValueSpec{
+		Name: value.Name(),
+		Type: type_name,
+		Data: value.Data(),
+	})
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,184 @@
+package regf
+
+import (
+	"encoding/binary"
+)
+
+// The deleted keys and values carved from the unallocated cells of
+// the hive. Deleted records keep their content until the cell is
+// reused.
+type deletedRecords struct {
+	// The offsets of all the carved records.
+	offsets map[uint32]bool
+
+	// Deleted keys by the offset of their parent key.
+	keys map[uint32][]*Key
+
+	// Deleted values by the offset of the key which owned them.
+	values map[uint32][]*Value
+}
+
+// Carve the unallocated cells of the hive for deleted keys and
+// values. Deleted keys still point at their parent key. Deleted values
+// have no reference to their key, but the previous value list of the
+// key is often still present in an unallocated cell - if the list
+// also references allocated values, the deleted values belong to the
+// key owning those.
+func (self *Hive) RecoverDeleted() {
+	if self.deleted != nil {
+		return
+	}
+
+	deleted := &deletedRecords{
+		offsets: make(map[uint32]bool),
+		keys:    make(map[uint32][]*Key),
+		values:  make(map[uint32][]*Value),
+	}
+	self.deleted = deleted
+
+	// The key owning each allocated value.
+	owners := make(map[uint32]uint32)
+	var lists [][]byte
+
+	self.walkCells(func(offset uint32, data []byte, allocated bool) {
+		if allocated {
+			if len(data) >= nk_header_size && string(data[:2]) == "nk" {
+				key := &Key{hive: self, offset: offset, nk: data}
+				for _, value := range key.Values() {
+					owners[value.offset] = offset
+				}
+			}
+			return
+		}
+		lists = append(lists, data)
+
+		// Free cells may have been merged so look for records at
+		// every cell boundary inside them.
+		for i := 0; i+2 <= len(data); i += 8 {
+			record_offset := offset + uint32(i)
+			switch string(data[i : i+2]) {
+			case "nk":
+				key, err := self.openKey(record_offset)
+				if err != nil {
+					continue
+				}
+
+				parent := binary.LittleEndian.Uint32(key.nk[16:])
+				if parent != record_offset {
+					deleted.offsets[record_offset] = true
+					deleted.keys[parent] = append(deleted.keys[parent], key)
+				}
+
+			case "vk":
+				_, err := self.openValue(record_offset)
+				if err == nil {
+					deleted.offsets[record_offset] = true
+				}
+			}
+		}
+	})
+
+	for _, list := range lists {
+		self.recoverValueList(list, owners)
+	}
+}
+
+// Try to interpret an unallocated cell as a previous value list.
+func (self *Hive) recoverValueList(list []byte, owners map[uint32]uint32) {
+	var values []*Value
+	owner, found := uint32(0), false
+
+	for i := 0; i+4 <= len(list); i += 4 {
+		offset := binary.LittleEndian.Uint32(list[i:])
+		if offset%8 != 0 {
+			break
+		}
+
+		value, err := self.openValue(offset)
+		if err != nil {
+			break
+		}
+
+		if self.deleted.offsets[offset] {
+			values = append(values, value)
+		} else if key_offset, pres := owners[offset]; pres && !found {
+			owner, found = key_offset, true
+		}
+	}
+
+	if !found {
+		return
+	}
+
+	seen := make(map[uint32]bool)
+	for _, value := range self.deleted.values[owner] {
+		seen[value.offset] = true
+	}
+
+	for _, value := range values {
+		if !seen[value.offset] {
+			seen[value.offset] = true
+			self.deleted.values[owner] = append(self.deleted.values[owner], value)
+		}
+	}
+}
+
+// Call cb with the data of every cell in the hive bins.
+func (self *Hive) walkCells(cb func(offset uint32, data []byte, allocated bool)) {
+	end := BASE_BLOCK_SIZE + int(self.HiveBinsDataSize)
+	if end > len(self.data) {
+		end = len(self.data)
+	}
+
+	for bin := BASE_BLOCK_SIZE; bin+HBIN_HEADER_SIZE <= end; {
+		bin_size := int(binary.LittleEndian.Uint32(self.data[bin+8:]))
+		if string(self.data[bin:bin+4]) != "hbin" ||
+			bin_size < HBIN_HEADER_SIZE || bin+bin_size > end {
+			return
+		}
+
+		for cell := bin + HBIN_HEADER_SIZE; cell+4 <= bin+bin_size; {
+			size := int(int32(binary.LittleEndian.Uint32(self.data[cell:])))
+			allocated := size < 0
+			if allocated {
+				size = -size
+			}
+
+			if size < 8 || cell+size > bin+bin_size {
+				break
+			}
+
+			cb(uint32(cell-BASE_BLOCK_SIZE), self.data[cell+4:cell+size], allocated)
+			cell += size
+		}
+		bin += bin_size
+	}
+}
+
+// Returns true if the key was carved from an unallocated cell (see
+// RecoverDeleted).
+func (self *Key) Deleted() bool {
+	return self.hive.deleted != nil && self.hive.deleted.offsets[self.offset]
+}
+
+// The deleted subkeys of the key (see RecoverDeleted).
+func (self *Key) DeletedSubkeys() []*Key {
+	if self.hive.deleted == nil {
+		return nil
+	}
+	return self.hive.deleted.keys[self.offset]
+}
+
+// The deleted values of the key (see RecoverDeleted).
+func (self *Key) DeletedValues() []*Value {
+	if self.hive.deleted == nil {
+		return nil
+	}
+	return self.hive.deleted.values[self.offset]
+}
+
+// Returns true if the value was carved from an unallocated cell (see
+// RecoverDeleted).
+func (self *Value) Deleted() bool {
+	return self.hive.deleted != nil && self.hive.deleted.offsets[self.offset]
+}
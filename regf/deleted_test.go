@@ -0,0 +1,143 @@
+package regf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverDeleted(t *testing.T) {
+	data, err := BuildHive(&HiveSpec{
+		LastWritten: "2024-01-02T03:04:05Z",
+		Root: KeySpec{
+			Keys: []KeySpec{{
+				Name: "Run",
+				Values: []ValueSpec{
+					{Name: "OneDrive", Data: `C:\OneDrive.exe`},
+					{Name: "Updater", Data: `C:\Temp\evil.exe`, Deleted: true},
+				},
+			}, {
+				Name: "Services",
+				Keys: []KeySpec{{
+					Name:    "Rclone",
+					Deleted: true,
+					Values: []ValueSpec{
+						{Name: "ImagePath", Data: `C:\rclone.exe`},
+					},
+					Keys: []KeySpec{{Name: "Parameters"}},
+				}},
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	hive, err := NewHive(data)
+	require.NoError(t, err)
+
+	root, err := hive.Root()
+	require.NoError(t, err)
+
+	// Deleted records are not visible.
+	run := root.OpenPath("Run")
+	require.NotNil(t, run)
+	assert.Equal(t, 1, len(run.Values()))
+	assert.Nil(t, root.OpenPath(`Services\Rclone`))
+	assert.Nil(t, run.DeletedValues())
+
+	hive.RecoverDeleted()
+
+	values := run.DeletedValues()
+	require.Equal(t, 1, len(values))
+	assert.Equal(t, "Updater", values[0].Name())
+	assert.Equal(t, `C:\Temp\evil.exe`, values[0].Decode())
+	assert.True(t, values[0].Deleted())
+	assert.False(t, run.Values()[0].Deleted())
+
+	services := root.OpenPath("Services")
+	keys := services.DeletedSubkeys()
+	require.Equal(t, 1, len(keys))
+	assert.Equal(t, "Rclone", keys[0].Name())
+	assert.True(t, keys[0].Deleted())
+	assert.False(t, services.Deleted())
+	assert.Equal(t, `C:\rclone.exe`, keys[0].Value("ImagePath").Decode())
+	assert.True(t, keys[0].Value("ImagePath").Deleted())
+
+	// Deleted keys are recovered recursively.
+	keys = keys[0].DeletedSubkeys()
+	require.Equal(t, 1, len(keys))
+	assert.Equal(t, "Parameters", keys[0].Name())
+}
+
+func TestCarveDeleted(t *testing.T) {
+	data, err := BuildHive(&HiveSpec{
+		LastWritten: "2024-01-02T03:04:05Z",
+		Root: KeySpec{
+			Keys: []KeySpec{{
+				Name:          "Run",
+				LastWriteTime: "2024-05-06T07:08:09.1234567Z",
+				Values: []ValueSpec{
+					{Name: "OneDrive", Data: `C:\OneDrive.exe`},
+					{Name: "Updater", Data: `C:\Temp\evil.exe`, Deleted: true},
+				},
+			}, {
+				Name: "Services",
+				Keys: []KeySpec{{
+					Name: "Tcpip",
+				}, {
+					Name:    "Rclone",
+					Deleted: true,
+					Values: []ValueSpec{
+						{Name: "Start", Type: "REG_DWORD", Data: 2},
+					},
+					Keys: []KeySpec{{Name: "Parameters"}},
+				}},
+			}, {
+				Name: "Clean",
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	hive, err := NewHive(data)
+	require.NoError(t, err)
+
+	spec, found := hive.CarveDeleted()
+	require.True(t, found)
+
+	carved_data, err := BuildHive(spec)
+	require.NoError(t, err)
+
+	carved, err := NewHive(carved_data)
+	require.NoError(t, err)
+
+	root, err := carved.Root()
+	require.NoError(t, err)
+
+	// Only the deleted records and their parents are kept.
+	names := []string{}
+	for _, key := range root.Subkeys() {
+		names = append(names, key.Name())
+	}
+	assert.Equal(t, []string{"Run", "Services"}, names)
+
+	run := root.OpenPath("Run")
+	require.Equal(t, 1, len(run.Values()))
+	assert.Equal(t, `C:\Temp\evil.exe`, run.Value("Updater").Decode())
+	assert.Equal(t, "2024-05-06T07:08:09.1234567Z",
+		run.LastWriteTime().Format(time.RFC3339Nano))
+
+	services := root.OpenPath("Services")
+	require.Equal(t, 1, len(services.Subkeys()))
+	assert.Equal(t, uint64(2),
+		root.OpenPath(`Services\Rclone`).Value("Start").Decode())
+	assert.NotNil(t, root.OpenPath(`Services\Rclone\Parameters`))
+
+	// Nothing is carved from a hive without deleted records.
+	clean, err := NewHive(carved_data)
+	require.NoError(t, err)
+
+	_, found = clean.CarveDeleted()
+	assert.False(t, found)
+}
@@ -0,0 +1,130 @@
+// Package regf implements a minimal parser for the Windows registry
+// REGF hive file format. It is used to run rules directly over raw
+// hive files without needing a Velociraptor binary.
+//
+// The format is described in
+// https://github.com/msuhanov/regf/blob/master/Windows%20registry%20file%20format%20specification.md
+package regf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	// The base block is always 4kb and all cell offsets are relative
+	// to the end of it.
+	BASE_BLOCK_SIZE  = 0x1000
+	HBIN_HEADER_SIZE = 0x20
+)
+
+var (
+	InvalidHiveError = errors.New("Invalid hive file")
+)
+
+type Hive struct {
+	data []byte
+
+	// Fields from the base block
+	PrimarySequence   uint32
+	SecondarySequence uint32
+	LastWritten       time.Time
+	MajorVersion      uint32
+	MinorVersion      uint32
+	RootCellOffset    uint32
+	HiveBinsDataSize  uint32
+	FileName          string
+
+	// The pages recovered from the transaction logs (see Replay)
+	replayed []dirtyPage
+
+	// The records carved by RecoverDeleted
+	deleted *deletedRecords
+}
+
+// Open a hive file from disk. The entire file is read into memory.
+func Open(path string) (*Hive, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	data, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHive(data)
+}
+
+// Parse a hive from an in memory buffer.
+func NewHive(data []byte) (*Hive, error) {
+	if len(data) < BASE_BLOCK_SIZE || string(data[:4]) != "regf" {
+		return nil, InvalidHiveError
+	}
+
+	self := &Hive{
+		data:              data,
+		PrimarySequence:   binary.LittleEndian.Uint32(data[4:]),
+		SecondarySequence: binary.LittleEndian.Uint32(data[8:]),
+		LastWritten:       filetime(binary.LittleEndian.Uint64(data[12:])),
+		MajorVersion:      binary.LittleEndian.Uint32(data[20:]),
+		MinorVersion:      binary.LittleEndian.Uint32(data[24:]),
+		RootCellOffset:    binary.LittleEndian.Uint32(data[36:]),
+		HiveBinsDataSize:  binary.LittleEndian.Uint32(data[40:]),
+		FileName:          utf16ToString(data[48 : 48+64]),
+	}
+
+	return self, nil
+}
+
+// The raw hive file (including any changes replayed from the logs).
+func (self *Hive) Bytes() []byte {
+	return self.data
+}
+
+// Dirty hives have mismatched sequence numbers - the transaction
+// logs contain data that was not yet flushed into the primary file.
+func (self *Hive) IsDirty() bool {
+	return self.PrimarySequence != self.SecondarySequence
+}
+
+func (self *Hive) Root() (*Key, error) {
+	return self.openKey(self.RootCellOffset)
+}
+
+// Returns the data of the cell at the offset (relative to the start
+// of the hive bins), not including the cell size field.
+func (self *Hive) cell(offset uint32) ([]byte, error) {
+	start := int64(offset) + BASE_BLOCK_SIZE
+	if offset == 0xffffffff || start+4 > int64(len(self.data)) {
+		return nil, fmt.Errorf("%w: cell offset %#x out of range",
+			InvalidHiveError, offset)
+	}
+
+	size := int64(int32(binary.LittleEndian.Uint32(self.data[start:])))
+	if size < 0 {
+		size = -size
+	}
+
+	if size < 4 || start+size > int64(len(self.data)) {
+		return nil, fmt.Errorf("%w: cell at %#x has invalid size %v",
+			InvalidHiveError, offset, size)
+	}
+
+	return self.data[start+4 : start+size], nil
+}
+
+// Convert a Windows FILETIME to a time.
+func filetime(ft uint64) time.Time {
+	// Number of 100ns intervals between 1601 and 1970
+	const epoch_delta = 116444736000000000
+	seconds := (int64(ft) - epoch_delta) / 10000000
+	nanos := ((int64(ft) - epoch_delta) % 10000000) * 100
+	return time.Unix(seconds, nanos).UTC()
+}
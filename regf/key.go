@@ -0,0 +1,233 @@
+package regf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	KEY_HIVE_EXIT  = 0x0002
+	KEY_HIVE_ENTRY = 0x0004
+	KEY_NO_DELETE  = 0x0008
+	KEY_SYM_LINK   = 0x0010
+	KEY_COMP_NAME  = 0x0020
+
+	// Offsets within the nk record
+	nk_header_size = 0x4c
+
+	// Subkey lists may nest (ri lists) - protect against loops.
+	max_list_depth = 10
+)
+
+// A Key represents an nk record in the hive.
+type Key struct {
+	hive   *Hive
+	offset uint32
+	nk     []byte
+}
+
+func (self *Hive) openKey(offset uint32) (*Key, error) {
+	data, err := self.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < nk_header_size || string(data[:2]) != "nk" {
+		return nil, fmt.Errorf("%w: cell at %#x is not a key",
+			InvalidHiveError, offset)
+	}
+
+	return &Key{hive: self, offset: offset, nk: data}, nil
+}
+
+func (self *Key) Offset() uint32 {
+	return self.offset
+}
+
+// Returns true if the key record was recovered from the transaction
+// logs.
+func (self *Key) Replayed() bool {
+	return self.hive.isReplayed(self.offset)
+}
+
+func (self *Key) Flags() uint16 {
+	return binary.LittleEndian.Uint16(self.nk[2:])
+}
+
+func (self *Key) LastWriteTime() time.Time {
+	return filetime(binary.LittleEndian.Uint64(self.nk[4:]))
+}
+
+func (self *Key) Name() string {
+	length := int(binary.LittleEndian.Uint16(self.nk[72:]))
+	if nk_header_size+length > len(self.nk) {
+		length = len(self.nk) - nk_header_size
+	}
+	name := self.nk[nk_header_size : nk_header_size+length]
+
+	if self.Flags()&KEY_COMP_NAME != 0 {
+		return latin1ToString(name)
+	}
+	return utf16ToString(name)
+}
+
+func (self *Key) ClassName() string {
+	offset := binary.LittleEndian.Uint32(self.nk[48:])
+	length := int(binary.LittleEndian.Uint16(self.nk[74:]))
+	if offset == 0xffffffff || length == 0 {
+		return ""
+	}
+
+	data, err := self.hive.cell(offset)
+	if err != nil || length > len(data) {
+		return ""
+	}
+	return utf16ToString(data[:length])
+}
+
+// Returns the raw self relative security descriptor from the sk
+// record.
+func (self *Key) SecurityDescriptor() []byte {
+	offset := binary.LittleEndian.Uint32(self.nk[44:])
+	data, err := self.hive.cell(offset)
+	if err != nil || len(data) < 20 || string(data[:2]) != "sk" {
+		return nil
+	}
+
+	length := int(binary.LittleEndian.Uint32(data[16:]))
+	if 20+length > len(data) {
+		return nil
+	}
+	return data[20 : 20+length]
+}
+
+func (self *Key) NumberOfSubkeys() int {
+	return int(binary.LittleEndian.Uint32(self.nk[20:]))
+}
+
+func (self *Key) NumberOfValues() int {
+	return int(binary.LittleEndian.Uint32(self.nk[36:]))
+}
+
+func (self *Key) Subkeys() []*Key {
+	if self.NumberOfSubkeys() == 0 {
+		return nil
+	}
+
+	offsets := self.hive.subkeyOffsets(
+		binary.LittleEndian.Uint32(self.nk[28:]), 0)
+
+	result := make([]*Key, 0, len(offsets))
+	for _, offset := range offsets {
+		key, err := self.hive.openKey(offset)
+		if err == nil {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// Find the subkey by name. Registry names are case insensitive.
+func (self *Key) Subkey(name string) *Key {
+	for _, key := range self.Subkeys() {
+		if strings.EqualFold(key.Name(), name) {
+			return key
+		}
+	}
+	return nil
+}
+
+// Open a key by path relative to this key. Path components may be
+// separated with either / or \.
+func (self *Key) OpenPath(path string) *Key {
+	key := self
+	for _, component := range strings.FieldsFunc(path, isPathSep) {
+		key = key.Subkey(component)
+		if key == nil {
+			return nil
+		}
+	}
+	return key
+}
+
+func (self *Key) Values() []*Value {
+	count := self.NumberOfValues()
+	if count == 0 {
+		return nil
+	}
+
+	list, err := self.hive.cell(binary.LittleEndian.Uint32(self.nk[40:]))
+	if err != nil {
+		return nil
+	}
+
+	if count*4 > len(list) {
+		count = len(list) / 4
+	}
+
+	result := make([]*Value, 0, count)
+	for i := 0; i < count; i++ {
+		value, err := self.hive.openValue(
+			binary.LittleEndian.Uint32(list[i*4:]))
+		if err == nil {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// Find the value by name. The default value has an empty name.
+func (self *Key) Value(name string) *Value {
+	for _, value := range self.Values() {
+		if strings.EqualFold(value.Name(), name) {
+			return value
+		}
+	}
+	return nil
+}
+
+// Walk the subkey list at offset and return the offsets of all the
+// nk records it references.
+func (self *Hive) subkeyOffsets(offset uint32, depth int) []uint32 {
+	if depth > max_list_depth {
+		return nil
+	}
+
+	data, err := self.cell(offset)
+	if err != nil || len(data) < 4 {
+		return nil
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[2:]))
+	entries := data[4:]
+
+	var result []uint32
+	switch string(data[:2]) {
+
+	// Fast leaf and hash leaf have an offset and a hint per entry.
+	case "lf", "lh":
+		for i := 0; i < count && i*8+4 <= len(entries); i++ {
+			result = append(result, binary.LittleEndian.Uint32(entries[i*8:]))
+		}
+
+	case "li":
+		for i := 0; i < count && i*4+4 <= len(entries); i++ {
+			result = append(result, binary.LittleEndian.Uint32(entries[i*4:]))
+		}
+
+	// Index root points at other subkey lists.
+	case "ri":
+		for i := 0; i < count && i*4+4 <= len(entries); i++ {
+			result = append(result, self.subkeyOffsets(
+				binary.LittleEndian.Uint32(entries[i*4:]), depth+1)...)
+		}
+	}
+
+	return result
+}
+
+func isPathSep(c rune) bool {
+	return c == '/' || c == '\\'
+}
@@ -0,0 +1,301 @@
+package regf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+var (
+	InvalidLogError = errors.New("Invalid transaction log")
+)
+
+const (
+	// The file type field of the base block of transaction logs.
+	LOG_OLD_FORMAT      = 1
+	LOG_OLD_FORMAT_XP   = 2
+	LOG_NEW_FORMAT      = 6
+	LOG_SECTOR_SIZE     = 0x200
+	LOG_ENTRY_HEADER    = 40
+	LOG_ENTRY_SIGNATURE = "HvLE"
+
+	// Old format logs store a bitmap of the dirty sectors of the hive
+	// bins after the base block.
+	dirty_vector_signature = "DIRT"
+
+	marvin32_seed = 0x82EF4D887A4E55C5
+)
+
+// A dirty page of the hive bins stored in a transaction log.
+type dirtyPage struct {
+	offset uint32
+	data   []byte
+}
+
+// An HvLE log entry of a new format transaction log.
+type logEntry struct {
+	sequence         uint32
+	hiveBinsDataSize uint32
+	pages            []dirtyPage
+}
+
+// Replay the transaction logs (the content of the .LOG1 and .LOG2
+// files) over the hive. The changes which were not yet flushed to the
+// primary file are applied to a copy of the hive - the keys and
+// values in the recovered pages are marked as replayed. Invalid or
+// stale logs are ignored, but an error is returned for valid entries
+// writing past the end of the hive bins.
+func (self *Hive) Replay(logs ...[]byte) (*Hive, error) {
+	var entries []*logEntry
+	var old_logs [][]byte
+
+	// The hive bins can only grow by the pages stored in the logs.
+	// This bounds the memory used to replay crafted logs.
+	max_hive_bins_data_size := uint64(self.HiveBinsDataSize)
+
+	for _, log := range logs {
+		if len(log) < LOG_SECTOR_SIZE || string(log[:4]) != "regf" {
+			continue
+		}
+		max_hive_bins_data_size += uint64(len(log))
+
+		switch binary.LittleEndian.Uint32(log[28:]) {
+		case LOG_NEW_FORMAT:
+			entries = append(entries, parseLogEntries(log)...)
+		case LOG_OLD_FORMAT, LOG_OLD_FORMAT_XP:
+			old_logs = append(old_logs, log)
+		}
+	}
+
+	data := append([]byte{}, self.data...)
+	var replayed []dirtyPage
+
+	// Pages must be within the hive bins data size given by the log.
+	apply := func(page dirtyPage, hive_bins_data_size uint32) error {
+		if uint64(hive_bins_data_size) > max_hive_bins_data_size ||
+			uint64(page.offset)+uint64(len(page.data)) > uint64(hive_bins_data_size) {
+			return fmt.Errorf("%w: dirty page at %#x is past the end of the hive bins (%#x)",
+				InvalidLogError, page.offset, hive_bins_data_size)
+		}
+
+		end := BASE_BLOCK_SIZE + int(page.offset) + len(page.data)
+		if end > len(data) {
+			data = append(data, make([]byte, end-len(data))...)
+		}
+		copy(data[BASE_BLOCK_SIZE+int(page.offset):], page.data)
+		replayed = append(replayed, page)
+		return nil
+	}
+
+	// Entries must be applied in sequence starting from the last
+	// write which completed in the primary file.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].sequence < entries[j].sequence
+	})
+
+	sequence := self.SecondarySequence
+	hive_bins_data_size := self.HiveBinsDataSize
+	for _, entry := range entries {
+		if entry.sequence < sequence {
+			continue
+		}
+
+		if entry.sequence != sequence {
+			break
+		}
+
+		for _, page := range entry.pages {
+			err := apply(page, entry.hiveBinsDataSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+		hive_bins_data_size = entry.hiveBinsDataSize
+		sequence++
+	}
+
+	// Old format logs are only written while the primary file is
+	// being updated.
+	if len(replayed) == 0 && self.IsDirty() {
+		for _, log := range old_logs {
+			pages := parseDirtyVector(log)
+			if len(pages) == 0 {
+				continue
+			}
+			hive_bins_data_size = binary.LittleEndian.Uint32(log[40:])
+			for _, page := range pages {
+				err := apply(page, hive_bins_data_size)
+				if err != nil {
+					return nil, err
+				}
+			}
+			sequence = self.PrimarySequence
+			break
+		}
+	}
+
+	if len(replayed) == 0 {
+		return self, nil
+	}
+
+	// The recovered hive is consistent.
+	binary.LittleEndian.PutUint32(data[4:], sequence)
+	binary.LittleEndian.PutUint32(data[8:], sequence)
+	binary.LittleEndian.PutUint32(data[40:], hive_bins_data_size)
+	binary.LittleEndian.PutUint32(data[508:], checksum(data[:BASE_BLOCK_SIZE]))
+
+	result, err := NewHive(data)
+	if err != nil {
+		return self, nil
+	}
+	result.replayed = replayed
+	return result, nil
+}
+
+// Returns true if some of the hive was recovered from the transaction
+// logs.
+func (self *Hive) Replayed() bool {
+	return len(self.replayed) > 0
+}
+
+// Returns true if the cell at offset was recovered from the
+// transaction logs.
+func (self *Hive) isReplayed(offset uint32) bool {
+	for _, page := range self.replayed {
+		if offset >= page.offset &&
+			offset < page.offset+uint32(len(page.data)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse the valid log entries of a new format log. The log is
+// truncated at the first invalid entry.
+func parseLogEntries(log []byte) []*logEntry {
+	var result []*logEntry
+
+	for offset := LOG_SECTOR_SIZE; offset+LOG_ENTRY_HEADER <= len(log); {
+		header := log[offset:]
+		if string(header[:4]) != LOG_ENTRY_SIGNATURE {
+			break
+		}
+
+		size := int(binary.LittleEndian.Uint32(header[4:]))
+		if size < LOG_ENTRY_HEADER || size%LOG_SECTOR_SIZE != 0 ||
+			offset+size > len(log) {
+			break
+		}
+
+		// Both hashes must match or the entry is a partial write.
+		data := log[offset : offset+size]
+		if binary.LittleEndian.Uint64(data[24:]) != marvin32(data[LOG_ENTRY_HEADER:]) ||
+			binary.LittleEndian.Uint64(data[32:]) != marvin32(data[:32]) {
+			break
+		}
+
+		entry := &logEntry{
+			sequence:         binary.LittleEndian.Uint32(data[12:]),
+			hiveBinsDataSize: binary.LittleEndian.Uint32(data[16:]),
+		}
+
+		count := int(binary.LittleEndian.Uint32(data[20:]))
+		page_start := LOG_ENTRY_HEADER + count*8
+		if count < 0 || page_start > size {
+			break
+		}
+
+		for i := 0; i < count; i++ {
+			reference := data[LOG_ENTRY_HEADER+i*8:]
+			page_size := int(binary.LittleEndian.Uint32(reference[4:]))
+			if page_size < 0 || page_start+page_size > size {
+				return result
+			}
+
+			entry.pages = append(entry.pages, dirtyPage{
+				offset: binary.LittleEndian.Uint32(reference),
+				data:   data[page_start : page_start+page_size],
+			})
+			page_start += page_size
+		}
+
+		result = append(result, entry)
+		offset += size
+	}
+
+	return result
+}
+
+// Parse the dirty sectors of an old format log. Each bit of the
+// dirty vector marks a sector of the hive bins and the dirty sectors
+// follow in order.
+func parseDirtyVector(log []byte) []dirtyPage {
+	hive_bins_data_size := int(binary.LittleEndian.Uint32(log[40:]))
+	bitmap_size := hive_bins_data_size / LOG_SECTOR_SIZE / 8
+	bitmap_start := LOG_SECTOR_SIZE + len(dirty_vector_signature)
+
+	if bitmap_start+bitmap_size > len(log) ||
+		string(log[LOG_SECTOR_SIZE:bitmap_start]) != dirty_vector_signature {
+		return nil
+	}
+
+	var result []dirtyPage
+	bitmap := log[bitmap_start : bitmap_start+bitmap_size]
+
+	// Sectors start on the next sector boundary.
+	offset := (bitmap_start + bitmap_size + LOG_SECTOR_SIZE - 1) &^
+		(LOG_SECTOR_SIZE - 1)
+
+	for i := 0; i < bitmap_size*8; i++ {
+		if bitmap[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
+
+		if offset+LOG_SECTOR_SIZE > len(log) {
+			return nil
+		}
+
+		result = append(result, dirtyPage{
+			offset: uint32(i * LOG_SECTOR_SIZE),
+			data:   log[offset : offset+LOG_SECTOR_SIZE],
+		})
+		offset += LOG_SECTOR_SIZE
+	}
+
+	return result
+}
+
+// The Marvin32 hash protecting the log entries.
+func marvin32(data []byte) uint64 {
+	lo := uint32(marvin32_seed & 0xffffffff)
+	hi := uint32(marvin32_seed >> 32)
+
+	block := func() {
+		hi ^= lo
+		lo = bits.RotateLeft32(lo, 20)
+		lo += hi
+		hi = bits.RotateLeft32(hi, 9)
+		hi ^= lo
+		lo = bits.RotateLeft32(lo, 27)
+		lo += hi
+		hi = bits.RotateLeft32(hi, 19)
+	}
+
+	for ; len(data) >= 4; data = data[4:] {
+		lo += binary.LittleEndian.Uint32(data)
+		block()
+	}
+
+	final := uint32(0x80)
+	for i := len(data) - 1; i >= 0; i-- {
+		final = final<<8 | uint32(data[i])
+	}
+
+	lo += final
+	block()
+	block()
+
+	return uint64(hi)<<32 | uint64(lo)
+}
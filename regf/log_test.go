@@ -0,0 +1,100 @@
+package regf
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runKeyHive(t *testing.T, values ...ValueSpec) []byte {
+	data, err := BuildHive(&HiveSpec{
+		LastWritten: "2024-01-02T03:04:05Z",
+		Root: KeySpec{
+			Keys: []KeySpec{{
+				Name:   "Run",
+				Values: values,
+			}},
+		},
+	})
+	require.NoError(t, err)
+	return data
+}
+
+func TestReplay(t *testing.T) {
+	primary := runKeyHive(t, ValueSpec{Name: "OneDrive", Data: `C:\OneDrive.exe`})
+	updated := runKeyHive(t,
+		ValueSpec{Name: "OneDrive", Data: `C:\OneDrive.exe`},
+		ValueSpec{Name: "Updater", Data: `C:\Temp\evil.exe`})
+
+	log, err := BuildLog(primary, updated)
+	require.NoError(t, err)
+
+	hive, err := NewHive(primary)
+	require.NoError(t, err)
+
+	// The new value is only in the log.
+	root, err := hive.Root()
+	require.NoError(t, err)
+	assert.Nil(t, root.OpenPath("Run").Value("Updater"))
+
+	// Logs which are not valid are ignored.
+	unchanged, err := hive.Replay(nil, []byte("regf"))
+	require.NoError(t, err)
+	assert.Equal(t, hive, unchanged)
+
+	replayed, err := hive.Replay([]byte{}, log)
+	require.NoError(t, err)
+	assert.True(t, replayed.Replayed())
+	assert.False(t, replayed.IsDirty())
+	assert.Equal(t, hive.SecondarySequence+1, replayed.SecondarySequence)
+
+	root, err = replayed.Root()
+	require.NoError(t, err)
+	value := root.OpenPath("Run").Value("Updater")
+	require.NotNil(t, value)
+	assert.Equal(t, `C:\Temp\evil.exe`, value.Decode())
+	assert.True(t, value.Replayed())
+	assert.True(t, root.OpenPath("Run").Replayed())
+
+	// The original hive is not modified.
+	assert.False(t, hive.Replayed())
+
+	// Entries already flushed to the primary file are skipped.
+	flushed := append([]byte{}, primary...)
+	binary.LittleEndian.PutUint32(flushed[4:], 2)
+	binary.LittleEndian.PutUint32(flushed[8:], 2)
+	flushed_hive, err := NewHive(flushed)
+	require.NoError(t, err)
+	unchanged, err = flushed_hive.Replay(log)
+	require.NoError(t, err)
+	assert.False(t, unchanged.Replayed())
+
+	// A corrupted entry is not applied.
+	corrupted := append([]byte{}, log...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	unchanged, err = hive.Replay(corrupted)
+	require.NoError(t, err)
+	assert.False(t, unchanged.Replayed())
+
+	// A valid entry writing past the end of the hive bins is an
+	// error.
+	crafted := append([]byte{}, log...)
+	entry := crafted[LOG_SECTOR_SIZE:]
+	binary.LittleEndian.PutUint32(entry[LOG_ENTRY_HEADER:], 0xfffff000)
+	binary.LittleEndian.PutUint64(entry[24:], marvin32(entry[LOG_ENTRY_HEADER:]))
+	binary.LittleEndian.PutUint64(entry[32:], marvin32(entry[:32]))
+	_, err = hive.Replay(crafted)
+	assert.ErrorIs(t, err, InvalidLogError)
+
+	// So is a hive bins data size larger than the logs could fill.
+	crafted = append([]byte{}, log...)
+	entry = crafted[LOG_SECTOR_SIZE:]
+	binary.LittleEndian.PutUint32(entry[16:], 0xfffff000)
+	binary.LittleEndian.PutUint32(entry[LOG_ENTRY_HEADER:], 0xffffe000)
+	binary.LittleEndian.PutUint64(entry[24:], marvin32(entry[LOG_ENTRY_HEADER:]))
+	binary.LittleEndian.PutUint64(entry[32:], marvin32(entry[:32]))
+	_, err = hive.Replay(crafted)
+	assert.ErrorIs(t, err, InvalidLogError)
+}
@@ -0,0 +1,225 @@
+package regf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	REG_NONE                       = 0
+	REG_SZ                         = 1
+	REG_EXPAND_SZ                  = 2
+	REG_BINARY                     = 3
+	REG_DWORD                      = 4
+	REG_DWORD_BIG_ENDIAN           = 5
+	REG_LINK                       = 6
+	REG_MULTI_SZ                   = 7
+	REG_RESOURCE_LIST              = 8
+	REG_FULL_RESOURCE_DESCRIPTOR   = 9
+	REG_RESOURCE_REQUIREMENTS_LIST = 10
+	REG_QWORD                      = 11
+
+	VALUE_COMP_NAME = 0x0001
+
+	// Data larger than this is stored in segments referenced from a
+	// db record (hive version 1.4 and later).
+	big_data_segment_size = 16344
+
+	vk_header_size = 0x14
+)
+
+var (
+	typeNames = map[uint32]string{
+		REG_NONE:                       "REG_NONE",
+		REG_SZ:                         "REG_SZ",
+		REG_EXPAND_SZ:                  "REG_EXPAND_SZ",
+		REG_BINARY:                     "REG_BINARY",
+		REG_DWORD:                      "REG_DWORD",
+		REG_DWORD_BIG_ENDIAN:           "REG_DWORD_BIG_ENDIAN",
+		REG_LINK:                       "REG_LINK",
+		REG_MULTI_SZ:                   "REG_MULTI_SZ",
+		REG_RESOURCE_LIST:              "REG_RESOURCE_LIST",
+		REG_FULL_RESOURCE_DESCRIPTOR:   "REG_FULL_RESOURCE_DESCRIPTOR",
+		REG_RESOURCE_REQUIREMENTS_LIST: "REG_RESOURCE_REQUIREMENTS_LIST",
+		REG_QWORD:                      "REG_QWORD",
+	}
+)
+
+func TypeName(value_type uint32) string {
+	name, pres := typeNames[value_type]
+	if pres {
+		return name
+	}
+	return fmt.Sprintf("REG_UNKNOWN_%d", value_type)
+}
+
+// A Value represents a vk record in the hive.
+type Value struct {
+	hive   *Hive
+	offset uint32
+	vk     []byte
+}
+
+func (self *Hive) openValue(offset uint32) (*Value, error) {
+	data, err := self.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < vk_header_size || string(data[:2]) != "vk" {
+		return nil, fmt.Errorf("%w: cell at %#x is not a value",
+			InvalidHiveError, offset)
+	}
+
+	return &Value{hive: self, offset: offset, vk: data}, nil
+}
+
+func (self *Value) Offset() uint32 {
+	return self.offset
+}
+
+// Returns true if the value record or its data was recovered from the
+// transaction logs.
+func (self *Value) Replayed() bool {
+	size := binary.LittleEndian.Uint32(self.vk[4:])
+	return self.hive.isReplayed(self.offset) ||
+		(size&0x80000000 == 0 &&
+			self.hive.isReplayed(binary.LittleEndian.Uint32(self.vk[8:])))
+}
+
+func (self *Value) Name() string {
+	length := int(binary.LittleEndian.Uint16(self.vk[2:]))
+	if vk_header_size+length > len(self.vk) {
+		length = len(self.vk) - vk_header_size
+	}
+	name := self.vk[vk_header_size : vk_header_size+length]
+
+	flags := binary.LittleEndian.Uint16(self.vk[16:])
+	if flags&VALUE_COMP_NAME != 0 {
+		return latin1ToString(name)
+	}
+	return utf16ToString(name)
+}
+
+func (self *Value) Type() uint32 {
+	return binary.LittleEndian.Uint32(self.vk[12:])
+}
+
+func (self *Value) TypeName() string {
+	return TypeName(self.Type())
+}
+
+// The raw data of the value.
+func (self *Value) Data() []byte {
+	size := binary.LittleEndian.Uint32(self.vk[4:])
+	offset_field := self.vk[8:12]
+
+	// Small data is stored directly in the offset field.
+	if size&0x80000000 != 0 {
+		size &= 0x7fffffff
+		if size > 4 {
+			size = 4
+		}
+		return append([]byte{}, offset_field[:size]...)
+	}
+
+	offset := binary.LittleEndian.Uint32(offset_field)
+	data, err := self.hive.cell(offset)
+	if err != nil {
+		return nil
+	}
+
+	if size > big_data_segment_size && len(data) >= 8 &&
+		string(data[:2]) == "db" {
+		return self.hive.bigData(data, int(size))
+	}
+
+	if int(size) > len(data) {
+		size = uint32(len(data))
+	}
+	return data[:size]
+}
+
+func (self *Hive) bigData(db []byte, size int) []byte {
+	count := int(binary.LittleEndian.Uint16(db[2:]))
+	list, err := self.cell(binary.LittleEndian.Uint32(db[4:]))
+	if err != nil {
+		return nil
+	}
+
+	result := make([]byte, 0, size)
+	for i := 0; i < count && i*4+4 <= len(list); i++ {
+		segment, err := self.cell(binary.LittleEndian.Uint32(list[i*4:]))
+		if err != nil {
+			return nil
+		}
+
+		remaining := size - len(result)
+		if remaining > big_data_segment_size {
+			remaining = big_data_segment_size
+		}
+		if remaining > len(segment) {
+			remaining = len(segment)
+		}
+		result = append(result, segment[:remaining]...)
+	}
+	return result
+}
+
+// Decode the value data into a Go type according to the value
+// type. Strings are returned as string, string lists as []string,
+// integers as uint64 and everything else as []byte.
+func (self *Value) Decode() interface{} {
+	return DecodeData(self.Type(), self.Data())
+}
+
+func DecodeData(value_type uint32, data []byte) interface{} {
+	switch value_type {
+	case REG_SZ, REG_EXPAND_SZ, REG_LINK:
+		return strings.TrimRight(utf16ToString(data), "\x00")
+
+	case REG_MULTI_SZ:
+		result := []string{}
+		for _, item := range strings.Split(utf16ToString(data), "\x00") {
+			if item != "" {
+				result = append(result, item)
+			}
+		}
+		return result
+
+	case REG_DWORD:
+		if len(data) >= 4 {
+			return uint64(binary.LittleEndian.Uint32(data))
+		}
+
+	case REG_DWORD_BIG_ENDIAN:
+		if len(data) >= 4 {
+			return uint64(binary.BigEndian.Uint32(data))
+		}
+
+	case REG_QWORD:
+		if len(data) >= 8 {
+			return binary.LittleEndian.Uint64(data)
+		}
+	}
+
+	return data
+}
+
+func utf16ToString(data []byte) string {
+	ints := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		ints = append(ints, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return strings.TrimRight(string(utf16.Decode(ints)), "\x00")
+}
+
+func latin1ToString(data []byte) string {
+	runes := make([]rune, 0, len(data))
+	for _, c := range data {
+		runes = append(runes, rune(c))
+	}
+	return string(runes)
+}
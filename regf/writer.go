@@ -0,0 +1,751 @@
+package regf
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/Velocidex/yaml/v2"
+)
+
+// A HiveSpec is a declarative description of a hive. It is used to
+// build small synthetic hives for testing rules.
+type HiveSpec struct {
+	// Stored in the base block (only the last 31 characters are kept).
+	FileName string `json:"FileName,omitempty"`
+
+	// RFC3339 timestamp used for the base block and as the default
+	// last write time of all keys.
+	LastWritten string `json:"LastWritten,omitempty"`
+
+	// The root key of the hive.
+	Root KeySpec `json:"Root"`
+}
+
+type KeySpec struct {
+	Name string `json:"Name"`
+
+	// RFC3339 timestamp, defaults to the hive's LastWritten.
+	LastWriteTime string `json:"LastWriteTime,omitempty"`
+	ClassName     string `json:"ClassName,omitempty"`
+
+	// Hex encoded self relative security descriptor. A default
+	// descriptor is used if not specified.
+	SecurityDescriptor string `json:"SecurityDescriptor,omitempty"`
+
+	Values []ValueSpec `json:"Values,omitempty"`
+	Keys   []KeySpec   `json:"Keys,omitempty"`
+
+	// The key is written to unallocated cells and not linked to its
+	// parent, like a deleted key.
+	Deleted bool `json:"Deleted,omitempty"`
+}
+
+type ValueSpec struct {
+	// The default value has an empty name (or @).
+	Name string `json:"Name"`
+
+	// One of the REG_* type names (default REG_SZ).
+	Type string `json:"Type,omitempty"`
+
+	// The data is interpreted according to the type: A string for
+	// REG_SZ, REG_EXPAND_SZ and REG_LINK, a list of strings for
+	// REG_MULTI_SZ, and an integer for REG_DWORD and REG_QWORD. Other
+	// types require the raw data as []byte or in Hex.
+	Data interface{} `json:"Data,omitempty"`
+
+	// Hex encoded raw data - overrides Data for any type.
+	Hex string `json:"Hex,omitempty"`
+
+	// The value is written to unallocated cells and is only
+	// referenced from a previous (unallocated) value list of the
+	// key, like a deleted value.
+	Deleted bool `json:"Deleted,omitempty"`
+}
+
+var (
+	// Owner BUILTIN\Administrators, Group SYSTEM, DACL allowing
+	// Everyone KEY_ALL_ACCESS.
+	defaultSecurityDescriptor = []byte{
+		0x01, 0x00, 0x04, 0x80, 0x14, 0x00, 0x00, 0x00,
+		0x24, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x30, 0x00, 0x00, 0x00,
+
+		// Owner S-1-5-32-544
+		0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05,
+		0x20, 0x00, 0x00, 0x00, 0x20, 0x02, 0x00, 0x00,
+
+		// Group S-1-5-18
+		0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05,
+		0x12, 0x00, 0x00, 0x00,
+
+		// DACL with a single ACE for S-1-1-0
+		0x02, 0x00, 0x1c, 0x00, 0x01, 0x00, 0x00, 0x00,
+		0x00, 0x02, 0x14, 0x00, 0x3f, 0x00, 0x0f, 0x00,
+		0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x00,
+	}
+)
+
+// Parse a hive specification from YAML.
+func LoadHiveSpec(data []byte) (*HiveSpec, error) {
+	spec := &HiveSpec{}
+	err := yaml.UnmarshalStrict(data, spec)
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func LoadHiveSpecFile(path string) (*HiveSpec, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	data, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadHiveSpec(data)
+}
+
+// Build the hive described by the spec and write it to path.
+func WriteHiveFile(spec *HiveSpec, path string) error {
+	data, err := BuildHive(spec)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// Build a new format transaction log holding a single log entry with
+// the pages of updated which differ from primary. Replaying the log
+// over primary recovers updated - this simulates a hive whose last
+// changes were not flushed.
+func BuildLog(primary, updated []byte) ([]byte, error) {
+	primary_hive, err := NewHive(primary)
+	if err != nil {
+		return nil, err
+	}
+
+	updated_hive, err := NewHive(updated)
+	if err != nil {
+		return nil, err
+	}
+
+	var references, pages []byte
+	count := 0
+	for offset := BASE_BLOCK_SIZE; offset < len(updated); offset += BASE_BLOCK_SIZE {
+		page := updated[offset : offset+BASE_BLOCK_SIZE]
+		if offset+BASE_BLOCK_SIZE <= len(primary) &&
+			string(primary[offset:offset+BASE_BLOCK_SIZE]) == string(page) {
+			continue
+		}
+
+		reference := make([]byte, 8)
+		binary.LittleEndian.PutUint32(reference, uint32(offset-BASE_BLOCK_SIZE))
+		binary.LittleEndian.PutUint32(reference[4:], BASE_BLOCK_SIZE)
+		references = append(references, reference...)
+		pages = append(pages, page...)
+		count++
+	}
+
+	entry := make([]byte, LOG_ENTRY_HEADER)
+	entry = append(entry, references...)
+	entry = append(entry, pages...)
+	for len(entry)%LOG_SECTOR_SIZE != 0 {
+		entry = append(entry, 0)
+	}
+
+	copy(entry, LOG_ENTRY_SIGNATURE)
+	binary.LittleEndian.PutUint32(entry[4:], uint32(len(entry)))
+	binary.LittleEndian.PutUint32(entry[12:], primary_hive.SecondarySequence)
+	binary.LittleEndian.PutUint32(entry[16:], updated_hive.HiveBinsDataSize)
+	binary.LittleEndian.PutUint32(entry[20:], uint32(count))
+	binary.LittleEndian.PutUint64(entry[24:], marvin32(entry[LOG_ENTRY_HEADER:]))
+	binary.LittleEndian.PutUint64(entry[32:], marvin32(entry[:32]))
+
+	// The log starts with the first sector of the primary base block.
+	base := append([]byte{}, primary[:LOG_SECTOR_SIZE]...)
+	binary.LittleEndian.PutUint32(base[28:], LOG_NEW_FORMAT)
+	binary.LittleEndian.PutUint32(base[508:], checksum(base))
+
+	return append(base, entry...), nil
+}
+
+type hiveWriter struct {
+	// The hive bins area - offsets are relative to the start of it.
+	bins []byte
+
+	// Offset of the current bin and the next free cell in it.
+	bin_start uint32
+	next      uint32
+
+	default_time uint64
+
+	// Security descriptors are shared between keys.
+	sk_cells map[string]uint32
+	sk_order []uint32
+}
+
+// Build a REGF hive from the specification.
+func BuildHive(spec *HiveSpec) ([]byte, error) {
+	last_written, err := parseTime(spec.LastWritten, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &hiveWriter{
+		default_time: last_written,
+		sk_cells:     make(map[string]uint32),
+	}
+
+	root_name := spec.Root.Name
+	if root_name == "" {
+		root_name = "ROOT"
+	}
+	root := spec.Root
+	root.Name = root_name
+
+	root_offset, err := self.writeKey(&root, 0xffffffff, true)
+	if err != nil {
+		return nil, err
+	}
+	self.closeBin()
+	self.linkSecurityCells()
+
+	base := make([]byte, BASE_BLOCK_SIZE)
+	copy(base, "regf")
+	binary.LittleEndian.PutUint32(base[4:], 1)
+	binary.LittleEndian.PutUint32(base[8:], 1)
+	binary.LittleEndian.PutUint64(base[12:], last_written)
+	binary.LittleEndian.PutUint32(base[20:], 1)
+	binary.LittleEndian.PutUint32(base[24:], 5)
+	binary.LittleEndian.PutUint32(base[32:], 1)
+	binary.LittleEndian.PutUint32(base[36:], root_offset)
+	binary.LittleEndian.PutUint32(base[40:], uint32(len(self.bins)))
+	binary.LittleEndian.PutUint32(base[44:], 1)
+
+	// Like Windows, keep the tail of long file names.
+	file_name := encodeUTF16(spec.FileName)
+	if len(file_name) > 62 {
+		file_name = file_name[len(file_name)-62:]
+	}
+	copy(base[48:], file_name)
+	binary.LittleEndian.PutUint32(base[508:], checksum(base))
+
+	// The first bin carries the timestamp.
+	binary.LittleEndian.PutUint64(self.bins[20:], last_written)
+
+	return append(base, self.bins...), nil
+}
+
+// The base block checksum is the XOR of the first 127 dwords.
+func checksum(base []byte) uint32 {
+	var result uint32
+	for i := 0; i < 508; i += 4 {
+		result ^= binary.LittleEndian.Uint32(base[i:])
+	}
+
+	switch result {
+	case 0xffffffff:
+		return 0xfffffffe
+	case 0:
+		return 1
+	}
+	return result
+}
+
+// Start a new bin large enough to hold a cell of the given size.
+func (self *hiveWriter) newBin(cell_size uint32) {
+	self.closeBin()
+
+	bin_size := uint32(0x1000)
+	for bin_size < cell_size+HBIN_HEADER_SIZE {
+		bin_size += 0x1000
+	}
+
+	self.bin_start = uint32(len(self.bins))
+	self.bins = append(self.bins, make([]byte, bin_size)...)
+
+	header := self.bins[self.bin_start:]
+	copy(header, "hbin")
+	binary.LittleEndian.PutUint32(header[4:], self.bin_start)
+	binary.LittleEndian.PutUint32(header[8:], bin_size)
+	self.next = self.bin_start + HBIN_HEADER_SIZE
+}
+
+// Mark the remaining space in the current bin as a free cell.
+func (self *hiveWriter) closeBin() {
+	end := uint32(len(self.bins))
+	if self.next < end {
+		binary.LittleEndian.PutUint32(self.bins[self.next:], end-self.next)
+		self.next = end
+	}
+}
+
+// Allocate a cell for data of the given length and return its offset.
+func (self *hiveWriter) alloc(length int) uint32 {
+	// Cells are 8 byte aligned and include the size field.
+	size := uint32(length+4+7) &^ 7
+	if len(self.bins) == 0 || self.next+size > uint32(len(self.bins)) {
+		self.newBin(size)
+	}
+
+	offset := self.next
+	binary.LittleEndian.PutUint32(self.bins[offset:], uint32(-int32(size)))
+	self.next += size
+	return offset
+}
+
+// The data of the allocated cell at offset.
+func (self *hiveWriter) cell(offset uint32) []byte {
+	size := uint32(-int32(binary.LittleEndian.Uint32(self.bins[offset:])))
+	return self.bins[offset+4 : offset+size]
+}
+
+// Mark the cells allocated between start and end as unallocated. The
+// shared security cells remain allocated.
+func (self *hiveWriter) free(start, end uint32) {
+	for offset := start; offset+4 <= end; {
+		if offset%BASE_BLOCK_SIZE == 0 &&
+			string(self.bins[offset:offset+4]) == "hbin" {
+			offset += HBIN_HEADER_SIZE
+			continue
+		}
+
+		size := int32(binary.LittleEndian.Uint32(self.bins[offset:]))
+		if size < 0 {
+			size = -size
+			if string(self.bins[offset+4:offset+6]) != "sk" {
+				binary.LittleEndian.PutUint32(self.bins[offset:], uint32(size))
+			}
+		}
+		offset += uint32(size)
+	}
+}
+
+func (self *hiveWriter) writeCell(data []byte) uint32 {
+	offset := self.alloc(len(data))
+	copy(self.cell(offset), data)
+	return offset
+}
+
+func (self *hiveWriter) writeKey(
+	spec *KeySpec, parent uint32, is_root bool) (uint32, error) {
+	last_write, err := parseTime(spec.LastWriteTime, self.default_time)
+	if err != nil {
+		return 0, fmt.Errorf("Key %v: %w", spec.Name, err)
+	}
+
+	name, compressed := encodeName(spec.Name)
+	offset := self.alloc(nk_header_size + len(name))
+
+	flags := uint16(0)
+	if compressed {
+		flags |= KEY_COMP_NAME
+	}
+	if is_root {
+		flags |= KEY_HIVE_ENTRY | KEY_NO_DELETE
+	}
+
+	sk_offset, err := self.writeSecurity(spec.SecurityDescriptor)
+	if err != nil {
+		return 0, fmt.Errorf("Key %v: %w", spec.Name, err)
+	}
+
+	class_offset := uint32(0xffffffff)
+	class_name := encodeUTF16(spec.ClassName)
+	if len(class_name) > 0 {
+		class_offset = self.writeCell(class_name)
+	}
+
+	values_offset := uint32(0xffffffff)
+	max_value_name := 0
+	max_value_data := 0
+	var values, all_values []byte
+	for i := range spec.Values {
+		v := &spec.Values[i]
+		start := self.next
+		vk_offset, name_len, data_len, err := self.writeValue(v)
+		if err != nil {
+			return 0, fmt.Errorf("Key %v: %w", spec.Name, err)
+		}
+
+		entry := make([]byte, 4)
+		binary.LittleEndian.PutUint32(entry, vk_offset)
+		all_values = append(all_values, entry...)
+
+		if v.Deleted {
+			self.free(start, self.next)
+			continue
+		}
+		values = append(values, entry...)
+
+		if name_len > max_value_name {
+			max_value_name = name_len
+		}
+		if data_len > max_value_data {
+			max_value_data = data_len
+		}
+	}
+
+	if len(values) > 0 {
+		values_offset = self.writeCell(values)
+	}
+
+	// The previous value list still references the deleted values.
+	if len(all_values) > len(values) {
+		start := self.next
+		self.writeCell(all_values)
+		self.free(start, self.next)
+	}
+
+	// Subkey lists must be sorted by upper case name.
+	var subkeys []KeySpec
+	for _, child := range spec.Keys {
+		if !child.Deleted {
+			subkeys = append(subkeys, child)
+			continue
+		}
+
+		// Deleted keys still point at their parent.
+		start := self.next
+		_, err := self.writeKey(&child, offset, false)
+		if err != nil {
+			return 0, err
+		}
+		self.free(start, self.next)
+	}
+
+	sort.SliceStable(subkeys, func(i, j int) bool {
+		return strings.ToUpper(subkeys[i].Name) < strings.ToUpper(subkeys[j].Name)
+	})
+
+	subkeys_offset := uint32(0xffffffff)
+	max_subkey_name := 0
+	max_subkey_class := 0
+	if len(subkeys) > 0 {
+		list := make([]byte, 4+8*len(subkeys))
+		copy(list, "lh")
+		binary.LittleEndian.PutUint16(list[2:], uint16(len(subkeys)))
+
+		for i := range subkeys {
+			child := &subkeys[i]
+			child_offset, err := self.writeKey(child, offset, false)
+			if err != nil {
+				return 0, err
+			}
+			binary.LittleEndian.PutUint32(list[4+i*8:], child_offset)
+			binary.LittleEndian.PutUint32(list[8+i*8:], nameHash(child.Name))
+
+			if len(child.Name)*2 > max_subkey_name {
+				max_subkey_name = len(child.Name) * 2
+			}
+			if len(child.ClassName)*2 > max_subkey_class {
+				max_subkey_class = len(child.ClassName) * 2
+			}
+		}
+		subkeys_offset = self.writeCell(list)
+	}
+
+	nk := self.cell(offset)
+	copy(nk, "nk")
+	binary.LittleEndian.PutUint16(nk[2:], flags)
+	binary.LittleEndian.PutUint64(nk[4:], last_write)
+	binary.LittleEndian.PutUint32(nk[16:], parent)
+	binary.LittleEndian.PutUint32(nk[20:], uint32(len(subkeys)))
+	binary.LittleEndian.PutUint32(nk[28:], subkeys_offset)
+	binary.LittleEndian.PutUint32(nk[32:], 0xffffffff)
+	binary.LittleEndian.PutUint32(nk[36:], uint32(len(values)/4))
+	binary.LittleEndian.PutUint32(nk[40:], values_offset)
+	binary.LittleEndian.PutUint32(nk[44:], sk_offset)
+	binary.LittleEndian.PutUint32(nk[48:], class_offset)
+	binary.LittleEndian.PutUint32(nk[52:], uint32(max_subkey_name))
+	binary.LittleEndian.PutUint32(nk[56:], uint32(max_subkey_class))
+	binary.LittleEndian.PutUint32(nk[60:], uint32(max_value_name))
+	binary.LittleEndian.PutUint32(nk[64:], uint32(max_value_data))
+	binary.LittleEndian.PutUint16(nk[72:], uint16(len(name)))
+	binary.LittleEndian.PutUint16(nk[74:], uint16(len(class_name)))
+	copy(nk[nk_header_size:], name)
+
+	return offset, nil
+}
+
+func (self *hiveWriter) writeSecurity(descriptor string) (uint32, error) {
+	sd := defaultSecurityDescriptor
+	if descriptor != "" {
+		decoded, err := decodeHex(descriptor)
+		if err != nil {
+			return 0, fmt.Errorf("SecurityDescriptor: %w", err)
+		}
+		sd = decoded
+	}
+
+	offset, pres := self.sk_cells[string(sd)]
+	if pres {
+		sk := self.cell(offset)
+		binary.LittleEndian.PutUint32(sk[12:],
+			binary.LittleEndian.Uint32(sk[12:])+1)
+		return offset, nil
+	}
+
+	data := make([]byte, 20+len(sd))
+	copy(data, "sk")
+	binary.LittleEndian.PutUint32(data[12:], 1)
+	binary.LittleEndian.PutUint32(data[16:], uint32(len(sd)))
+	copy(data[20:], sd)
+
+	offset = self.writeCell(data)
+	self.sk_cells[string(sd)] = offset
+	self.sk_order = append(self.sk_order, offset)
+	return offset, nil
+}
+
+// Security cells form a circular doubly linked list.
+func (self *hiveWriter) linkSecurityCells() {
+	count := len(self.sk_order)
+	for i, offset := range self.sk_order {
+		sk := self.cell(offset)
+		binary.LittleEndian.PutUint32(sk[4:], self.sk_order[(i+count-1)%count])
+		binary.LittleEndian.PutUint32(sk[8:], self.sk_order[(i+1)%count])
+	}
+}
+
+// Returns the offset of the vk cell, the name length and data length.
+func (self *hiveWriter) writeValue(spec *ValueSpec) (uint32, int, int, error) {
+	value_type, data, err := encodeValue(spec)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("Value %v: %w", spec.Name, err)
+	}
+
+	value_name := spec.Name
+	if value_name == "@" {
+		value_name = ""
+	}
+	name, compressed := encodeName(value_name)
+
+	vk := make([]byte, vk_header_size+len(name))
+	copy(vk, "vk")
+	binary.LittleEndian.PutUint16(vk[2:], uint16(len(name)))
+	binary.LittleEndian.PutUint32(vk[12:], value_type)
+	if compressed {
+		binary.LittleEndian.PutUint16(vk[16:], VALUE_COMP_NAME)
+	}
+	copy(vk[vk_header_size:], name)
+
+	switch {
+	// Small data is stored inline in the offset field.
+	case len(data) <= 4:
+		binary.LittleEndian.PutUint32(vk[4:], uint32(len(data))|0x80000000)
+		copy(vk[8:12], data)
+
+	case len(data) > big_data_segment_size:
+		binary.LittleEndian.PutUint32(vk[4:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(vk[8:], self.writeBigData(data))
+
+	default:
+		binary.LittleEndian.PutUint32(vk[4:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(vk[8:], self.writeCell(data))
+	}
+
+	return self.writeCell(vk), len(name), len(data), nil
+}
+
+func (self *hiveWriter) writeBigData(data []byte) uint32 {
+	var segments []uint32
+	for len(data) > 0 {
+		length := big_data_segment_size
+		if length > len(data) {
+			length = len(data)
+		}
+		segments = append(segments, self.writeCell(data[:length]))
+		data = data[length:]
+	}
+
+	list := make([]byte, 4*len(segments))
+	for i, s := range segments {
+		binary.LittleEndian.PutUint32(list[i*4:], s)
+	}
+
+	db := make([]byte, 8)
+	copy(db, "db")
+	binary.LittleEndian.PutUint16(db[2:], uint16(len(segments)))
+	binary.LittleEndian.PutUint32(db[4:], self.writeCell(list))
+	return self.writeCell(db)
+}
+
+func typeFromName(name string) (uint32, error) {
+	if name == "" {
+		return REG_SZ, nil
+	}
+
+	for k, v := range typeNames {
+		if strings.EqualFold(v, name) {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown value type %v", name)
+}
+
+func encodeValue(spec *ValueSpec) (uint32, []byte, error) {
+	value_type, err := typeFromName(spec.Type)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if spec.Hex != "" {
+		data, err := decodeHex(spec.Hex)
+		return value_type, data, err
+	}
+
+	if raw, ok := spec.Data.([]byte); ok {
+		return value_type, raw, nil
+	}
+
+	switch value_type {
+	case REG_SZ, REG_EXPAND_SZ, REG_LINK:
+		str, ok := spec.Data.(string)
+		if !ok && spec.Data != nil {
+			str = fmt.Sprintf("%v", spec.Data)
+		}
+		return value_type, encodeUTF16(str + "\x00"), nil
+
+	case REG_MULTI_SZ:
+		var items []string
+		switch t := spec.Data.(type) {
+		case []string:
+			items = t
+		case []interface{}:
+			for _, i := range t {
+				items = append(items, fmt.Sprintf("%v", i))
+			}
+		case nil:
+		default:
+			return 0, nil, fmt.Errorf("REG_MULTI_SZ requires a list")
+		}
+		return value_type, encodeUTF16(
+			strings.Join(items, "\x00") + "\x00\x00"), nil
+
+	case REG_DWORD, REG_DWORD_BIG_ENDIAN, REG_QWORD:
+		number, err := toUint64(spec.Data)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch value_type {
+		case REG_DWORD:
+			data := make([]byte, 4)
+			binary.LittleEndian.PutUint32(data, uint32(number))
+			return value_type, data, nil
+
+		case REG_DWORD_BIG_ENDIAN:
+			data := make([]byte, 4)
+			binary.BigEndian.PutUint32(data, uint32(number))
+			return value_type, data, nil
+
+		default:
+			data := make([]byte, 8)
+			binary.LittleEndian.PutUint64(data, number)
+			return value_type, data, nil
+		}
+	}
+
+	if spec.Data == nil {
+		return value_type, nil, nil
+	}
+
+	if str, ok := spec.Data.(string); ok {
+		return value_type, []byte(str), nil
+	}
+
+	return 0, nil, fmt.Errorf("%v requires Hex or raw data", TypeName(value_type))
+}
+
+func toUint64(data interface{}) (uint64, error) {
+	switch t := data.(type) {
+	case int:
+		return uint64(t), nil
+	case int32:
+		return uint64(t), nil
+	case int64:
+		return uint64(t), nil
+	case uint32:
+		return uint64(t), nil
+	case uint64:
+		return t, nil
+	case float64:
+		return uint64(t), nil
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("Expected an integer not %T", data)
+}
+
+// Names are stored as latin1 when possible.
+func encodeName(name string) ([]byte, bool) {
+	result := make([]byte, 0, len(name))
+	for _, c := range name {
+		if c > 0xff {
+			return encodeUTF16(name), false
+		}
+		result = append(result, byte(c))
+	}
+	return result, true
+}
+
+func encodeUTF16(in string) []byte {
+	encoded := utf16.Encode([]rune(in))
+	result := make([]byte, len(encoded)*2)
+	for i, c := range encoded {
+		binary.LittleEndian.PutUint16(result[i*2:], c)
+	}
+	return result
+}
+
+// The hash used in lh lists.
+func nameHash(name string) uint32 {
+	var result uint32
+	for _, c := range strings.ToUpper(name) {
+		result = result*37 + uint32(c)
+	}
+	return result
+}
+
+func decodeHex(in string) ([]byte, error) {
+	return hex.DecodeString(strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\n', '\t', '\r', ':':
+			return -1
+		}
+		return r
+	}, in))
+}
+
+func parseTime(in string, default_value uint64) (uint64, error) {
+	if in == "" {
+		return default_value, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, in)
+	if err != nil {
+		return 0, err
+	}
+	return ToFiletime(t), nil
+}
+
+// Convert a time to a Windows FILETIME.
+func ToFiletime(t time.Time) uint64 {
+	const epoch_delta = 116444736000000000
+	return uint64(t.UnixNano()/100 + epoch_delta)
+}
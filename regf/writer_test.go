@@ -0,0 +1,96 @@
+package regf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHive(t *testing.T) {
+	spec, err := LoadHiveSpecFile("fixtures/System.yaml")
+	require.NoError(t, err)
+
+	data, err := BuildHive(spec)
+	require.NoError(t, err)
+
+	hive, err := NewHive(data)
+	require.NoError(t, err)
+	assert.False(t, hive.IsDirty())
+	assert.Equal(t, `stemRoot\System32\Config\SYSTEM`, hive.FileName)
+	assert.Equal(t, uint32(len(data)-BASE_BLOCK_SIZE), hive.HiveBinsDataSize)
+
+	root, err := hive.Root()
+	require.NoError(t, err)
+	assert.Equal(t, "ROOT", root.Name())
+	assert.Equal(t, KEY_HIVE_ENTRY, int(root.Flags()&KEY_HIVE_ENTRY))
+
+	// Subkeys are sorted by name
+	names := []string{}
+	for _, k := range root.Subkeys() {
+		names = append(names, k.Name())
+	}
+	assert.Equal(t, []string{"ControlSet001", "Select"}, names)
+
+	control_set := root.OpenPath("controlset001")
+	require.NotNil(t, control_set)
+	assert.Equal(t, "ControlSetClass", control_set.ClassName())
+	assert.Equal(t, "2023-10-18T02:46:48Z",
+		control_set.LastWriteTime().Format(time.RFC3339))
+	assert.Equal(t, defaultSecurityDescriptor, control_set.SecurityDescriptor())
+
+	service := root.OpenPath(`ControlSet001\Services\Rclone`)
+	require.NotNil(t, service)
+	assert.Equal(t, "2024-01-02T03:04:05Z",
+		service.LastWriteTime().Format(time.RFC3339))
+
+	assert.Equal(t, `%SystemRoot%\rclone.exe`, service.Value("ImagePath").Decode())
+	assert.Equal(t, "REG_EXPAND_SZ", service.Value("ImagePath").TypeName())
+	assert.Equal(t, uint64(2), service.Value("Start").Decode())
+	assert.Equal(t, []string{"Tcpip", "Dnscache"},
+		service.Value("DependOnService").Decode())
+	assert.Equal(t, "Default value", service.Value("").Decode())
+	assert.Equal(t, []byte{0x80, 0x51, 0x01, 0, 0, 0, 0, 0},
+		service.Value("FailureActions").Decode())
+}
+
+func TestWriteHiveLargeValues(t *testing.T) {
+	big := strings.Repeat("A", 40000)
+	spec := &HiveSpec{
+		Root: KeySpec{
+			Keys: []KeySpec{{
+				Name:      "Ünïcode Кey",
+				ClassName: "Class",
+				Values: []ValueSpec{
+					{Name: "Big", Type: "REG_BINARY", Data: []byte(big)},
+					{Name: "Empty", Type: "REG_NONE"},
+					{Name: "Quad", Type: "REG_QWORD", Data: uint64(1) << 40},
+					{Name: "BigEndian", Type: "REG_DWORD_BIG_ENDIAN", Data: 1},
+				},
+			}},
+		},
+	}
+
+	data, err := BuildHive(spec)
+	require.NoError(t, err)
+
+	hive, err := NewHive(data)
+	require.NoError(t, err)
+
+	root, err := hive.Root()
+	require.NoError(t, err)
+
+	key := root.Subkey("ünïcode кey")
+	require.NotNil(t, key)
+	assert.Equal(t, "Ünïcode Кey", key.Name())
+	assert.Equal(t, []byte(big), key.Value("Big").Decode())
+	assert.Equal(t, []byte{}, key.Value("Empty").Data())
+	assert.Equal(t, uint64(1)<<40, key.Value("Quad").Decode())
+	assert.Equal(t, uint64(1), key.Value("BigEndian").Decode())
+
+	_, err = BuildHive(&HiveSpec{Root: KeySpec{
+		Values: []ValueSpec{{Name: "X", Type: "REG_FOO"}}}})
+	assert.Error(t, err)
+}
@@ -171,6 +171,11 @@ var (
 		"Description", "Category", "OSPath", "Mtime", "Details",
 	}
 
+	// The columns tagging the control set and the keys recovered from
+	// the transaction logs or carved from the unallocated cells.
+	recoveryColumns = append(standardColumns,
+		"ControlSet", "Replayed", "Deleted")
+
 	testCases = []testCase{
 		// Cover off on all the different hives we are supposed to map
 		{
@@ -294,6 +299,15 @@ var (
 			Root:       reghiveTestDirectory,
 			Columns:    standardColumns,
 		},
+		{
+			// Covers the ControlSet, Replayed and Deleted columns
+			// of the primary hives.
+			Name:       "Services Recovery Columns",
+			Artifact:   "Windows.Registry.Hunter/Results",
+			RuleFilter: "Services",
+			Root:       reghiveTestDirectory,
+			Columns:    recoveryColumns,
+		},
 	}
 )
 
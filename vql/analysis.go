@@ -0,0 +1,120 @@
+package vql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	lambdaRegex = regexp.MustCompile(`^\s*x\s*=>`)
+
+	keywords = map[string]bool{
+		"SELECT": true, "FROM": true, "WHERE": true, "LET": true,
+		"AND": true, "OR": true, "NOT": true, "IN": true, "AS": true,
+		"LIMIT": true, "ORDER": true, "BY": true, "GROUP": true,
+		"DESC": true, "EXPLAIN": true, "NULL": true, "TRUE": true,
+		"FALSE": true,
+	}
+
+	closing = map[string]string{")": "(", "]": "[", "}": "{"}
+)
+
+// Rule Details and Filters are lambdas of the form x=>...
+func IsLambda(text string) bool {
+	return lambdaRegex.MatchString(text)
+}
+
+func IsKeyword(name string) bool {
+	return keywords[strings.ToUpper(name)]
+}
+
+// Check that all brackets are balanced.
+func CheckBrackets(tokens []*Token) error {
+	stack := []*Token{}
+	for _, t := range tokens {
+		if t.Type != TOKEN_BRACKET {
+			continue
+		}
+
+		open, is_closing := closing[t.Value]
+		if !is_closing {
+			stack = append(stack, t)
+			continue
+		}
+
+		if len(stack) == 0 {
+			return &SyntaxError{
+				Message: fmt.Sprintf("Unexpected %q", t.Value),
+				Line:    t.Line, Column: t.Column,
+			}
+		}
+
+		top := stack[len(stack)-1]
+		if top.Value != open {
+			return &SyntaxError{
+				Message: fmt.Sprintf("Unexpected %q to close %q at line %v column %v",
+					t.Value, top.Value, top.Line, top.Column),
+				Line: t.Line, Column: t.Column,
+			}
+		}
+		stack = stack[:len(stack)-1]
+	}
+
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return &SyntaxError{
+			Message: fmt.Sprintf("Unclosed %q", top.Value),
+			Line:    top.Line, Column: top.Column,
+		}
+	}
+	return nil
+}
+
+// A name defined by a LET statement.
+type Definition struct {
+	Name string
+
+	// The LET defines a function (i.e. has parameters).
+	IsFunction bool
+
+	Token *Token
+}
+
+// Find all the names defined with LET.
+func Definitions(tokens []*Token) []*Definition {
+	var result []*Definition
+	for i, t := range tokens {
+		if !t.Is("LET") || i+1 >= len(tokens) ||
+			tokens[i+1].Type != TOKEN_IDENT {
+			continue
+		}
+
+		name := tokens[i+1]
+		result = append(result, &Definition{
+			Name:       strings.Trim(name.Value, "`"),
+			IsFunction: i+2 < len(tokens) && tokens[i+2].Value == "(",
+			Token:      name,
+		})
+	}
+	return result
+}
+
+// Find all function or plugin calls - identifiers followed by an
+// opening bracket. Member access (e.g. x.Foo()) and keywords are
+// excluded.
+func Calls(tokens []*Token) []*Token {
+	var result []*Token
+	for i, t := range tokens {
+		if t.Type != TOKEN_IDENT || IsKeyword(t.Value) ||
+			i+1 >= len(tokens) || tokens[i+1].Value != "(" {
+			continue
+		}
+
+		if i > 0 && (tokens[i-1].Value == "." || tokens[i-1].Is("LET")) {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
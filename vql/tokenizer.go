@@ -0,0 +1,213 @@
+// Package vql implements a lightweight VQL tokenizer. It is not a
+// full parser - it understands just enough of the syntax to check the
+// VQL snippets embedded in rules without needing a Velociraptor
+// binary.
+package vql
+
+import (
+	"fmt"
+	"strings"
+)
+
+type TokenType int
+
+const (
+	TOKEN_IDENT TokenType = iota
+	TOKEN_STRING
+	TOKEN_NUMBER
+	TOKEN_OPERATOR
+	TOKEN_BRACKET
+	TOKEN_OTHER
+)
+
+type Token struct {
+	Type  TokenType
+	Value string
+
+	// Position of the token within the text (1 based).
+	Line   int
+	Column int
+}
+
+func (self *Token) String() string {
+	return fmt.Sprintf("%q at line %v column %v", self.Value, self.Line, self.Column)
+}
+
+// Is the token the identifier or operator value (keywords are case
+// insensitive)?
+func (self *Token) Is(value string) bool {
+	if self.Type == TOKEN_IDENT {
+		return strings.EqualFold(self.Value, value)
+	}
+	return self.Value == value
+}
+
+type SyntaxError struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (self *SyntaxError) Error() string {
+	return fmt.Sprintf("%v at line %v column %v", self.Message, self.Line, self.Column)
+}
+
+// Longest operators first.
+var operators = []string{
+	"=>", "=~", "<=", ">=", "!=", "==", "||", "&&",
+	"=", "<", ">", "+", "-", "*", "/", "%", ".", ",", ":", "|", "!", ";",
+}
+
+type tokenizer struct {
+	text   string
+	offset int
+	line   int
+	column int
+	tokens []*Token
+}
+
+func (self *tokenizer) peek(s string) bool {
+	return strings.HasPrefix(self.text[self.offset:], s)
+}
+
+// Advance over n bytes keeping track of lines.
+func (self *tokenizer) advance(n int) {
+	for i := 0; i < n && self.offset < len(self.text); i++ {
+		if self.text[self.offset] == '\n' {
+			self.line++
+			self.column = 1
+		} else {
+			self.column++
+		}
+		self.offset++
+	}
+}
+
+func (self *tokenizer) errorf(line, column int,
+	format string, args ...interface{}) error {
+	return &SyntaxError{
+		Message: fmt.Sprintf(format, args...),
+		Line:    line,
+		Column:  column,
+	}
+}
+
+func (self *tokenizer) emit(token_type TokenType, start, line, column int) {
+	self.tokens = append(self.tokens, &Token{
+		Type:   token_type,
+		Value:  self.text[start:self.offset],
+		Line:   line,
+		Column: column,
+	})
+}
+
+// Tokenize VQL text. Comments and whitespace are dropped. Strings are
+// kept with their quotes.
+func Tokenize(text string) ([]*Token, error) {
+	self := &tokenizer{text: text, line: 1, column: 1}
+
+	for self.offset < len(self.text) {
+		start, line, column := self.offset, self.line, self.column
+		c := self.text[self.offset]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			self.advance(1)
+
+		case self.peek("--") || self.peek("//"):
+			end := strings.IndexByte(self.text[self.offset:], '\n')
+			if end < 0 {
+				end = len(self.text) - self.offset
+			}
+			self.advance(end)
+
+		case self.peek("/*"):
+			end := strings.Index(self.text[self.offset+2:], "*/")
+			if end < 0 {
+				return nil, self.errorf(line, column, "Unterminated comment")
+			}
+			self.advance(end + 4)
+
+		case self.peek("'''"):
+			end := strings.Index(self.text[self.offset+3:], "'''")
+			if end < 0 {
+				return nil, self.errorf(line, column, "Unterminated string")
+			}
+			self.advance(end + 6)
+			self.emit(TOKEN_STRING, start, line, column)
+
+		case c == '"' || c == '\'' || c == '`':
+			err := self.quoted(c)
+			if err != nil {
+				return nil, err
+			}
+			token_type := TOKEN_STRING
+
+			// Backticks quote identifiers
+			if c == '`' {
+				token_type = TOKEN_IDENT
+			}
+			self.emit(token_type, start, line, column)
+
+		case isIdentStart(c):
+			for self.offset < len(self.text) && isIdentChar(self.text[self.offset]) {
+				self.advance(1)
+			}
+			self.emit(TOKEN_IDENT, start, line, column)
+
+		case c >= '0' && c <= '9':
+			for self.offset < len(self.text) && (isIdentChar(self.text[self.offset]) ||
+				self.text[self.offset] == '.') {
+				self.advance(1)
+			}
+			self.emit(TOKEN_NUMBER, start, line, column)
+
+		case strings.IndexByte("()[]{}", c) >= 0:
+			self.advance(1)
+			self.emit(TOKEN_BRACKET, start, line, column)
+
+		default:
+			token_type := TOKEN_OTHER
+			length := 1
+			for _, op := range operators {
+				if self.peek(op) {
+					token_type = TOKEN_OPERATOR
+					length = len(op)
+					break
+				}
+			}
+			self.advance(length)
+			self.emit(token_type, start, line, column)
+		}
+	}
+
+	return self.tokens, nil
+}
+
+// Consume a quoted string honoring backslash escapes.
+func (self *tokenizer) quoted(quote byte) error {
+	line, column := self.line, self.column
+	self.advance(1)
+
+	for self.offset < len(self.text) {
+		c := self.text[self.offset]
+		switch {
+		case c == '\\' && quote != '`':
+			self.advance(2)
+		case c == quote:
+			self.advance(1)
+			return nil
+		default:
+			self.advance(1)
+		}
+	}
+	return self.errorf(line, column, "Unterminated string")
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
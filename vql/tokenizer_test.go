@@ -0,0 +1,71 @@
+package vql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func values(tokens []*Token) []string {
+	result := []string{}
+	for _, t := range tokens {
+		result = append(result, t.Value)
+	}
+	return result
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize(`
+-- A comment
+LET Foo(OSPath) = SELECT *, x.Bar AS ` + "`Baz Q`" + ` /* inline */
+  FROM glob(globs='''C:\*''', root="a\"b")
+  WHERE Name =~ 'x' AND Size >= 10.5`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"LET", "Foo", "(", "OSPath", ")", "=", "SELECT", "*", ",",
+		"x", ".", "Bar", "AS", "`Baz Q`",
+		"FROM", "glob", "(", "globs", "=", `'''C:\*'''`, ",",
+		"root", "=", `"a\"b"`, ")",
+		"WHERE", "Name", "=~", `'x'`, "AND", "Size", ">=", "10.5",
+	}, values(tokens))
+
+	// Positions are tracked
+	assert.Equal(t, 3, tokens[0].Line)
+	assert.Equal(t, 1, tokens[0].Column)
+	assert.Equal(t, 4, tokens[15].Line)
+	assert.Equal(t, 8, tokens[15].Column)
+
+	_, err = Tokenize(`x=>format(format="%v, args=x)`)
+	assert.EqualError(t, err, "Unterminated string at line 1 column 18")
+
+	_, err = Tokenize(`SELECT * /* FROM info()`)
+	assert.Error(t, err)
+}
+
+func TestAnalysis(t *testing.T) {
+	assert.True(t, IsLambda(" x => x.Data"))
+	assert.False(t, IsLambda("y=>y.Data"))
+	assert.False(t, IsLambda("FetchKeyValues(OSPath=x.OSPath)"))
+
+	tokens, err := Tokenize(`LET Foo(X) = dict(a={ SELECT * FROM Bar(Y=X.Baz()) })
+LET Table <= SELECT * FROM info() WHERE NOT (1 AND count())`)
+	assert.NoError(t, err)
+	assert.NoError(t, CheckBrackets(tokens))
+
+	definitions := Definitions(tokens)
+	assert.Equal(t, 2, len(definitions))
+	assert.Equal(t, "Foo", definitions[0].Name)
+	assert.True(t, definitions[0].IsFunction)
+	assert.Equal(t, "Table", definitions[1].Name)
+	assert.False(t, definitions[1].IsFunction)
+
+	assert.Equal(t, []string{"dict", "Bar", "info", "count"},
+		values(Calls(tokens)))
+
+	tokens, _ = Tokenize("dict(a=[1, 2)]")
+	assert.EqualError(t, CheckBrackets(tokens),
+		`Unexpected ")" to close "[" at line 1 column 8 at line 1 column 13`)
+
+	tokens, _ = Tokenize("dict(a={")
+	assert.EqualError(t, CheckBrackets(tokens), `Unclosed "{" at line 1 column 8`)
+}